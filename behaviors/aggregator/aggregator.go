@@ -12,6 +12,11 @@ package aggregator // import "tideland.dev/go/cells/behaviors/aggregator"
 //--------------------
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -34,19 +39,27 @@ const (
 // and event and returns the next status payload.
 type AggregatorFunc func(status interface{}, evt *mesh.Event) (interface{}, error)
 
+// TypedAggregatorFunc is a function receiving the current status and the
+// decoded payload of an event and returns the next status.
+type TypedAggregatorFunc[S, T any] func(status S, payload T) (S, error)
+
 //--------------------
 // BEHAVIOR
 //--------------------
 
 // Behavior provides a behavior which aggregates the stream of events with
-// a given function. A received "reset!" topic resets the status.
+// a given function. A received "reset!" topic resets the status, "aggregate!"
+// emits it or replies it in case of a request. The status can be saved and
+// restored as snapshot in JSON.
 type Behavior struct {
+	mu         sync.Mutex
 	initialize func() interface{}
 	status     interface{}
 	aggregate  AggregatorFunc
 }
 
 var _ mesh.Behavior = (*Behavior)(nil)
+var _ mesh.Snapshotter = (*Behavior)(nil)
 
 // New creates an instance of the aggregator behavior with the given
 // aggregator function.The initializer function creates the first value
@@ -63,6 +76,26 @@ func New(initializer func() interface{}, aggregator AggregatorFunc) *Behavior {
 	return b
 }
 
+// NewTyped creates an instance of the aggregator behavior working with a
+// status of type S and event payloads of type T. Events with payloads not
+// matching T let the behavior fail.
+func NewTyped[S, T any](initializer func() S, aggregator TypedAggregatorFunc[S, T]) *Behavior {
+	var initialize func() interface{}
+	if initializer != nil {
+		initialize = func() interface{} {
+			return initializer()
+		}
+	}
+	return New(initialize, func(status interface{}, evt *mesh.Event) (interface{}, error) {
+		payload, err := mesh.PayloadAs[T](evt)
+		if err != nil {
+			return nil, err
+		}
+		typedStatus, _ := status.(S)
+		return aggregator(typedStatus, payload)
+	})
+}
+
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
 	for {
@@ -70,28 +103,144 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case <-cell.Context().Done():
 			return nil
 		case evt := <-in.Pull():
-			switch evt.Topic() {
-			case TopicAggregate:
-				if err := out.Emit(TopicAggregateDone, b.status); err != nil {
-					return err
-				}
-			case TopicReset:
-				b.status = nil
-				if b.initialize != nil {
-					b.status = b.initialize()
-				}
-				if err := out.Emit(TopicResetDone, b.status); err != nil {
-					return err
-				}
-			default:
-				status, err := b.aggregate(b.status, evt)
-				if err != nil {
-					return err
-				}
-				b.status = status
+			if err := b.process(evt, out); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// Snapshot implements the mesh.Snapshotter interface.
+func (b *Behavior) Snapshot() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return json.Marshal(b.status)
+}
+
+// Restore implements the mesh.Snapshotter interface. The status is
+// decoded into the type of the initial status, without initializer
+// into the generic JSON types.
+func (b *Behavior) Restore(data []byte) error {
+	var status interface{}
+	if b.initialize != nil {
+		if initial := b.initialize(); initial != nil {
+			ptr := reflect.New(reflect.TypeOf(initial))
+			if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+				return err
+			}
+			status = ptr.Elem().Interface()
+		}
+	}
+	if status == nil {
+		if err := json.Unmarshal(data, &status); err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status = status
+	return nil
+}
+
+// process handles one received event. The status is only locked
+// while it is changed or read, so that emitting to slow subscribers
+// doesn't block snapshots.
+func (b *Behavior) process(evt *mesh.Event, out mesh.Emitter) error {
+	switch evt.Topic() {
+	case TopicAggregate:
+		b.mu.Lock()
+		status := b.status
+		b.mu.Unlock()
+		if evt.IsRequest() {
+			return evt.Reply(TopicAggregateDone, status)
+		}
+		return out.Emit(TopicAggregateDone, status)
+	case TopicReset:
+		var status interface{}
+		if b.initialize != nil {
+			status = b.initialize()
+		}
+		b.mu.Lock()
+		b.status = status
+		b.mu.Unlock()
+		return out.Emit(TopicResetDone, status)
+	default:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		status, err := b.aggregate(b.status, evt)
+		if err != nil {
+			return err
+		}
+		b.status = status
+	}
+	return nil
+}
+
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "aggregator"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates an aggregator behavior. The parameter "operation"
+// is "count" (default) for counting the events per topic or "sum" for
+// summing up numeric payloads. For payloads which are objects "field"
+// names the numeric field to sum up.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	operation, err := params.String("operation", "count")
+	if err != nil {
+		return nil, err
+	}
+	field, err := params.String("field", "")
+	if err != nil {
+		return nil, err
+	}
+	switch operation {
+	case "count":
+		return New(
+			func() interface{} { return make(map[string]int) },
+			func(status interface{}, evt *mesh.Event) (interface{}, error) {
+				counts := status.(map[string]int)
+				counts[evt.Topic()]++
+				return counts, nil
+			},
+		), nil
+	case "sum":
+		return New(
+			func() interface{} { return 0.0 },
+			func(status interface{}, evt *mesh.Event) (interface{}, error) {
+				value, err := numericPayload(evt, field)
+				if err != nil {
+					return nil, err
+				}
+				return status.(float64) + value, nil
+			},
+		), nil
+	}
+	return nil, fmt.Errorf("invalid operation '%s'", operation)
+}
+
+// numericPayload returns the payload or the named field of it as float.
+func numericPayload(evt *mesh.Event, field string) (float64, error) {
+	if field == "" {
+		return mesh.PayloadAs[float64](evt)
+	}
+	fields, err := mesh.PayloadAs[map[string]interface{}](evt)
+	if err != nil {
+		return 0.0, err
+	}
+	value, ok := fields[field].(float64)
+	if !ok {
+		return 0.0, fmt.Errorf("payload field '%s' is not numeric", field)
+	}
+	return value, nil
+}
+
 // EOF
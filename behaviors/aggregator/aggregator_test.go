@@ -12,6 +12,7 @@ package aggregator_test // import "tideland.dev/go/cells/behaviors/aggregator"
 //--------------------
 
 import (
+	"context"
 	"strconv"
 	"testing"
 	"time"
@@ -71,4 +72,129 @@ func TestAggregatorBehavior(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestAggregatorRequest tests the retrieval of the aggregated status
+// via request.
+func TestAggregatorRequest(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aggregatorFunc := func(aggregated interface{}, evt *mesh.Event) (interface{}, error) {
+		return aggregated.(int) + 1, nil
+	}
+	msh := mesh.New(ctx)
+	msh.Go("aggregator", aggregator.New(func() interface{} { return 0 }, aggregatorFunc))
+
+	for i := 0; i < 10; i++ {
+		msh.Emit("aggregator", "count")
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "aggregator", aggregator.TopicAggregate)
+	assert.NoError(err)
+	assert.Equal(reply.Topic(), aggregator.TopicAggregateDone)
+	var count int
+	assert.NoError(reply.Payload(&count))
+	assert.Equal(count, 10)
+}
+
+// TestTypedAggregator tests the aggregator behavior with typed status
+// and payloads.
+func TestTypedAggregator(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior := aggregator.NewTyped(
+		func() int { return 0 },
+		func(sum int, value int) (int, error) { return sum + value, nil },
+	)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 1 })
+			evt, ok := tbe.First()
+			tbe.Assert(ok, "cannot retrieve first event")
+			sum, err := mesh.PayloadAs[int](evt)
+			tbe.Assert(err == nil, "retrieving of payload failed: %v", err)
+			tbe.Assert(sum == 55, "invalid sum: %d", sum)
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		for i := 1; i <= 10; i++ {
+			out.Emit("value", i)
+		}
+		out.Emit(aggregator.TopicAggregate)
+	}, time.Second)
+	assert.NoError(err)
+}
+
+// TestSnapshot tests restoring the status of an aggregator out of the
+// snapshot of another one.
+func TestSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := mesh.DefaultBehaviorRegistry()
+	behavior, err := registry.Create(aggregator.Kind, nil)
+	assert.NoError(err)
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("first", behavior))
+	msh.Emit("first", "a")
+	msh.Emit("first", "b")
+	msh.Emit("first", "a")
+	assert.NoError(msh.Stop("first"))
+	data, err := behavior.(mesh.Snapshotter).Snapshot()
+	assert.NoError(err)
+
+	// Count status is restored typed, so counting goes on.
+	behavior, err = registry.Create(aggregator.Kind, nil)
+	assert.NoError(err)
+	assert.NoError(behavior.(mesh.Snapshotter).Restore(data))
+	assert.NoError(msh.Go("second", behavior))
+	msh.Emit("second", "b")
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "second", aggregator.TopicAggregate)
+	assert.NoError(err)
+	counts, err := mesh.PayloadAs[map[string]int](reply)
+	assert.NoError(err)
+	assert.Equal(counts, map[string]int{"a": 2, "b": 2})
+
+	// Without initializer the status is restored generic.
+	untyped := aggregator.New(nil, nil)
+	assert.NoError(untyped.Restore([]byte(`{"a":1}`)))
+	data, err = untyped.Snapshot()
+	assert.NoError(err)
+	assert.Equal(string(data), `{"a":1}`)
+	assert.ErrorContains(untyped.Restore([]byte("{broken")), "invalid character")
+}
+
+// TestFactory verifies the creation of aggregators by the registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	registry := mesh.DefaultBehaviorRegistry()
+	_, err := registry.Create(aggregator.Kind, mesh.BehaviorParams{"operation": "median"})
+	assert.ErrorContains(err, "invalid operation 'median'")
+	behavior, err := registry.Create(aggregator.Kind, mesh.BehaviorParams{
+		"operation": "sum",
+		"field":     "value",
+	})
+	assert.NoError(err)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 1 })
+			evt, _ := tbe.First()
+			sum, err := mesh.PayloadAs[float64](evt)
+			tbe.Assert(err == nil && sum == 6.5, "invalid sum: %v", evt)
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		out.Emit("reading", map[string]float64{"value": 1.5})
+		out.Emit("reading", map[string]float64{"value": 5.0})
+		out.Emit(aggregator.TopicAggregate)
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -43,4 +43,22 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "broadcaster"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a broadcaster behavior. It needs no parameters.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	return New(), nil
+}
+
 // EOF
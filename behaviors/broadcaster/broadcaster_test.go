@@ -44,4 +44,27 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestHeaders verifies that broadcasted events keep their headers.
+func TestHeaders(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior := broadcaster.New()
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.AssertRetry(func() bool { return tbe.Len() == 2 }, "broadcasted events not 2: %v", tbe)
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				tenant, ok := evt.Header("tenant")
+				tbe.Assert(ok && tenant == "acme", "header of event %d lost: %v", i, evt)
+				return nil
+			})
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		out.Emit("one", mesh.WithHeader("tenant", "acme"))
+		out.Emit("two", mesh.WithHeader("tenant", "acme"))
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
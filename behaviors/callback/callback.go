@@ -57,4 +57,23 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "callback"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a callback behavior without callbacks. So it works
+// as a sink consuming all events. It needs no parameters.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	return New(), nil
+}
+
 // EOF
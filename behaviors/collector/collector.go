@@ -12,6 +12,8 @@ package collector // import "tideland.dev/go/cells/behaviors/collector"
 //--------------------
 
 import (
+	"sync"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -38,15 +40,18 @@ type CollectionProcessorFunc func(r mesh.EventSinkReader) (*mesh.Event, error)
 
 // Behavior collects a wanted number of events. If the number grows too much the oldest
 // one will be deleted. When it's receiving an event with "process!" topic it calls the
-// process function and emits the result event. In case of a "reset!" topic the collection
-// will be dropped to zero.
+// process function and emits the result event, or replies it in case of a request. In case
+// of a "reset!" topic the collection will be dropped to zero. The collected events can be
+// saved and restored as snapshot.
 type Behavior struct {
+	mu      sync.Mutex
 	max     int
 	sink    mesh.EventSink
 	process CollectionProcessorFunc
 }
 
 var _ mesh.Behavior = (*Behavior)(nil)
+var _ mesh.Snapshotter = (*Behavior)(nil)
 
 // New creates a new collector behavior instance.
 func New(max int, process CollectionProcessorFunc) *Behavior {
@@ -64,22 +69,91 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case <-cell.Context().Done():
 			return cell.Context().Err()
 		case evt := <-in.Pull():
-			switch evt.Topic() {
-			case TopicReset:
-				b.sink.Clear()
-				out.Emit(TopicResetDone)
-			case TopicProcess:
-				pevt, err := b.process(b.sink)
-				if err != nil {
-					return err
-				}
-				out.EmitEvent(pevt)
-				b.sink.Clear()
-			default:
-				b.sink.Push(evt)
+			if err := b.handle(evt, out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Snapshot implements the mesh.Snapshotter interface.
+func (b *Behavior) Snapshot() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return mesh.EventSinkSnapshot(b.sink)
+}
+
+// Restore implements the mesh.Snapshotter interface.
+func (b *Behavior) Restore(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return mesh.EventSinkRestore(b.sink, data)
+}
+
+// handle handles one received event.
+func (b *Behavior) handle(evt *mesh.Event, out mesh.Emitter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch evt.Topic() {
+	case TopicReset:
+		b.sink.Clear()
+		out.Emit(TopicResetDone)
+	case TopicProcess:
+		pevt, err := b.process(b.sink)
+		if err != nil {
+			return err
+		}
+		if evt.IsRequest() {
+			if err := evt.ReplyEvent(pevt); err != nil {
+				return err
 			}
+		} else {
+			out.EmitEvent(pevt)
 		}
+		b.sink.Clear()
+	default:
+		b.sink.Push(evt)
 	}
+	return nil
+}
+
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "collector"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a collector behavior. The parameter "max" limits
+// the number of collected events, by default it's unlimited. When
+// processing an event with the topic "topic", by default "collected",
+// and all collected events as payload is emitted.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	max, err := params.Int("max", 0)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := params.String("topic", "collected")
+	if err != nil {
+		return nil, err
+	}
+	return New(max, func(r mesh.EventSinkReader) (*mesh.Event, error) {
+		evts := make([]*mesh.Event, 0, r.Len())
+		err := r.Do(func(index int, evt *mesh.Event) error {
+			evts = append(evts, evt)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mesh.NewEvent(topic, evts)
+	}), nil
 }
 
 // EOF
@@ -12,6 +12,7 @@ package collector_test // import "tideland.dev/go/cells/behaviors/collector"
 //--------------------
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -62,4 +63,75 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestRequest verifies the processing of the collected events
+// via request.
+func TestRequest(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processor := func(r mesh.EventSinkReader) (*mesh.Event, error) {
+		return mesh.NewEvent("length", r.Len())
+	}
+	msh := mesh.New(ctx)
+	msh.Go("collector", collector.New(10, processor))
+
+	for i := 0; i < 5; i++ {
+		msh.Emit("collector", "collect")
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "collector", collector.TopicProcess)
+	assert.NoError(err)
+	assert.Equal(reply.Topic(), "length")
+	var l int
+	assert.NoError(reply.Payload(&l))
+	assert.Equal(l, 5)
+}
+
+// TestSnapshot verifies the periodic snapshots of the collected events.
+func TestSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processor := func(r mesh.EventSinkReader) (*mesh.Event, error) {
+		var topics []string
+		r.Do(func(i int, evt *mesh.Event) error {
+			topics = append(topics, evt.Topic())
+			return nil
+		})
+		return mesh.NewEvent("topics", topics)
+	}
+	store, err := mesh.NewFileSnapshotStore(t.TempDir())
+	assert.NoError(err)
+	clock := mesh.NewManualClock(time.Now())
+
+	msh := mesh.New(ctx, mesh.WithClock(clock), mesh.WithSnapshots(store, time.Minute))
+	msh.Go("collector", collector.New(10, processor))
+	for _, topic := range []string{"a", "b", "c"} {
+		msh.Emit("collector", topic)
+	}
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("collector")
+		return err == nil && info.Processed == 3
+	}, 100, 10*time.Millisecond)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	assert.Retry(func() bool {
+		data, err := store.Load("collector")
+		return err == nil && data != nil
+	}, 100, 10*time.Millisecond)
+
+	// Restored when started in a new mesh.
+	msh = mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	msh.Go("collector", collector.New(10, processor))
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "collector", collector.TopicProcess)
+	assert.NoError(err)
+	var topics []string
+	assert.NoError(reply.Payload(&topics))
+	assert.Equal(topics, []string{"a", "b", "c"})
+}
+
 // EOF
@@ -12,7 +12,9 @@ package combo // import "tideland.dev/go/cells/behaviors/combo"
 //--------------------
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"tideland.dev/go/cells/mesh"
 )
@@ -59,12 +61,15 @@ const (
 
 // Behavior checks the event stream for a combination of events defined by
 // a criterion function. In case of a match an according event is emitted.
+// The collected events can be saved and restored as snapshot.
 type Behavior struct {
+	mu      sync.Mutex
 	matches ComboCriterionFunc
 	sink    mesh.EventSink
 }
 
 var _ mesh.Behavior = (*Behavior)(nil)
+var _ mesh.Snapshotter = (*Behavior)(nil)
 
 // New creates an instance of the combo behavior using the given criterion
 // function.
@@ -82,31 +87,108 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case <-cell.Context().Done():
 			return nil
 		case evt := <-in.Pull():
-			switch evt.Topic() {
-			case TopicReset:
-				b.sink.Clear()
-				out.Emit(TopicResetDone)
-			default:
-				b.sink.Push(evt)
-				matches, data, err := b.matches(b.sink)
-				if err != nil {
-					return err
-				}
-				switch matches {
-				case CriterionDone:
-					out.Emit(TopicCriterionDone, data)
-					b.sink.Clear()
-				case CriterionKeep:
-				case CriterionDropFirst:
-					b.sink.Shift()
-				case CriterionDropLast:
-					b.sink.Pop()
-				default:
-					return fmt.Errorf("invalid criterion matcher result: %v", matches)
-				}
+			if err := b.process(evt, out); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// Snapshot implements the mesh.Snapshotter interface.
+func (b *Behavior) Snapshot() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return mesh.EventSinkSnapshot(b.sink)
+}
+
+// Restore implements the mesh.Snapshotter interface.
+func (b *Behavior) Restore(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return mesh.EventSinkRestore(b.sink, data)
+}
+
+// process handles one received event.
+func (b *Behavior) process(evt *mesh.Event, out mesh.Emitter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch evt.Topic() {
+	case TopicReset:
+		b.sink.Clear()
+		out.Emit(TopicResetDone)
+	default:
+		b.sink.Push(evt)
+		matches, data, err := b.matches(b.sink)
+		if err != nil {
+			return err
+		}
+		switch matches {
+		case CriterionDone:
+			out.Emit(TopicCriterionDone, data)
+			b.sink.Clear()
+		case CriterionKeep:
+		case CriterionDropFirst:
+			b.sink.Shift()
+		case CriterionDropLast:
+			b.sink.Pop()
+		default:
+			return fmt.Errorf("invalid criterion matcher result: %v", matches)
+		}
+	}
+	return nil
+}
+
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "combo"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a combo behavior waiting for events with all of the
+// topics of the parameter "topics". Other events are dropped. When all
+// topics have been received a list with the last event per topic is
+// emitted.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	topics, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	return New(func(r mesh.EventSinkReader) (CriterionMatch, interface{}, error) {
+		last, _ := r.Last()
+		found := false
+		for _, topic := range topics {
+			if last.Topic() == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return CriterionDropLast, nil, nil
+		}
+		latest := make(map[string]*mesh.Event)
+		r.Do(func(index int, evt *mesh.Event) error {
+			latest[evt.Topic()] = evt
+			return nil
+		})
+		if len(latest) < len(topics) {
+			return CriterionKeep, nil, nil
+		}
+		evts := make([]*mesh.Event, len(topics))
+		for i, topic := range topics {
+			evts[i] = latest[topic]
+		}
+		return CriterionDone, evts, nil
+	}), nil
+}
+
 // EOF
@@ -12,6 +12,7 @@ package combo_test // import "tideland.dev/go/cells/behaviors/combo"
 //--------------------
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -89,4 +90,68 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestFactory verifies the creation of combos by the registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior, err := mesh.DefaultBehaviorRegistry().Create(combo.Kind, mesh.BehaviorParams{
+		"topics": []interface{}{"door-open", "motion"},
+	})
+	assert.NoError(err)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 1 })
+			evt, _ := tbe.First()
+			evts, err := mesh.PayloadAs[[]*mesh.Event](evt)
+			tbe.Assert(err == nil, "invalid payload: %v", err)
+			tbe.Assert(len(evts) == 2, "invalid number of combined events: %v", evts)
+			tbe.Assert(evts[0].Topic() == "door-open" && evts[1].Topic() == "motion", "invalid events: %v", evts)
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		out.Emit("motion")
+		out.Emit("light")
+		out.Emit("door-open")
+	}, time.Second)
+	assert.NoError(err)
+}
+
+// TestSnapshot verifies that a restored combo continues with the
+// events collected before.
+func TestSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	params := mesh.BehaviorParams{
+		"topics": []interface{}{"door-open", "motion"},
+	}
+	behavior, err := mesh.DefaultBehaviorRegistry().Create(combo.Kind, params)
+	assert.NoError(err)
+	msh := mesh.New(context.Background())
+	assert.NoError(msh.Go("combo", behavior))
+	msh.Emit("combo", "door-open")
+	assert.NoError(msh.Stop("combo"))
+	data, err := behavior.(mesh.Snapshotter).Snapshot()
+	assert.NoError(err)
+
+	behavior, err = mesh.DefaultBehaviorRegistry().Create(combo.Kind, params)
+	assert.NoError(err)
+	assert.NoError(behavior.(mesh.Snapshotter).Restore(data))
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 1 })
+			evt, _ := tbe.First()
+			evts, err := mesh.PayloadAs[[]*mesh.Event](evt)
+			tbe.Assert(err == nil, "invalid payload: %v", err)
+			tbe.Assert(len(evts) == 2, "invalid number of combined events: %v", evts)
+			tbe.Assert(evts[0].Topic() == "door-open" && evts[1].Topic() == "motion", "invalid events: %v", evts)
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		out.Emit("motion")
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -12,6 +12,8 @@ package condition // import "tideland.dev/go/cells/behaviors/condition"
 //--------------------
 
 import (
+	"errors"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -62,4 +64,53 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "condition"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a condition behavior for events whose topics match
+// one of the patterns of the parameter "topics". Those events are
+// re-emitted, or if the parameter "topic" is set, emitted with that
+// topic.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	topic, err := params.String("topic", "")
+	if err != nil {
+		return nil, err
+	}
+	return New(
+		func(evt *mesh.Event) bool {
+			return mesh.MatchTopics(patterns, evt.Topic())
+		},
+		func(cell mesh.Cell, evt *mesh.Event, out mesh.Emitter) error {
+			if topic == "" {
+				return out.EmitEvent(evt)
+			}
+			derived, err := evt.Derive(topic)
+			if err != nil {
+				return err
+			}
+			return out.EmitEvent(derived)
+		},
+	), nil
+}
+
 // EOF
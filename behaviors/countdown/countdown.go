@@ -12,6 +12,8 @@ package countdown // import "tideland.dev/go/cells/behaviors/countdown"
 //--------------------
 
 import (
+	"errors"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -67,4 +69,37 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "countdown"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a countdown behavior counting down from the parameter
+// "count". When zero it emits an event with the topic "topic", by default
+// "zero", and the number of counted events as payload.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	count, err := params.Int("count", 0)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		return nil, errors.New("parameter 'count' has to be positive")
+	}
+	topic, err := params.String("topic", "zero")
+	if err != nil {
+		return nil, err
+	}
+	return New(count, func(r mesh.EventSinkReader) (*mesh.Event, error) {
+		return mesh.NewEvent(topic, r.Len())
+	}), nil
+}
+
 // EOF
@@ -58,4 +58,33 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestFactory verifies the creation of countdowns by the registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	registry := mesh.DefaultBehaviorRegistry()
+	_, err := registry.Create(countdown.Kind, nil)
+	assert.ErrorContains(err, "parameter 'count' has to be positive")
+	behavior, err := registry.Create(countdown.Kind, mesh.BehaviorParams{"count": 3, "topic": "done"})
+	assert.NoError(err)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 2 })
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				count, err := mesh.PayloadAs[int](evt)
+				tbe.Assert(evt.Topic() == "done", "invalid topic: %v", evt)
+				tbe.Assert(err == nil && count == 3, "invalid count: %v", evt)
+				return nil
+			})
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		for i := 0; i < 7; i++ {
+			out.Emit("tick")
+		}
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -12,6 +12,9 @@ package counter // import "tideland.dev/go/cells/behaviors/counter"
 //--------------------
 
 import (
+	"encoding/json"
+	"sync"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -41,13 +44,16 @@ type CounterEvaluationFunc func(evt *mesh.Event) ([]string, error)
 // Behavior evaluates incoming events with a given CounterEvaluationFunc. This
 // function decides by returning a number of identifiers, which counter will
 // be incremented. All counters can be reset with the topic "reset!" and the
-// counters sent by "counters!".
+// counters sent by "counters!". In case of a request they are replied instead.
+// The counters can be saved and restored as snapshot.
 type Behavior struct {
+	mu      sync.Mutex
 	eval    CounterEvaluationFunc
 	counter map[string]int
 }
 
 var _ mesh.Behavior = (*Behavior)(nil)
+var _ mesh.Snapshotter = (*Behavior)(nil)
 
 // New instantiatas a counter behavior with the given evaluator.
 func New(eval CounterEvaluationFunc) *Behavior {
@@ -64,25 +70,103 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case <-cell.Context().Done():
 			return nil
 		case evt := <-in.Pull():
-			switch evt.Topic() {
-			case TopicReset:
-				b.counter = make(map[string]int)
-				out.Emit(TopicResetDone)
-			case TopicCounters:
-				if err := out.Emit(TopicCountersDone, b.counter); err != nil {
-					return err
-				}
-			default:
-				incrs, err := b.eval(evt)
-				if err != nil {
-					return err
-				}
-				for _, incr := range incrs {
-					b.counter[incr]++
-				}
+			if err := b.process(evt, out); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// Snapshot implements the mesh.Snapshotter interface.
+func (b *Behavior) Snapshot() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return json.Marshal(b.counter)
+}
+
+// Restore implements the mesh.Snapshotter interface.
+func (b *Behavior) Restore(data []byte) error {
+	counter := make(map[string]int)
+	if err := json.Unmarshal(data, &counter); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counter = counter
+	return nil
+}
+
+// process handles one received event. The counters are only locked
+// while they are changed or copied, so that emitting to slow
+// subscribers doesn't block snapshots.
+func (b *Behavior) process(evt *mesh.Event, out mesh.Emitter) error {
+	switch evt.Topic() {
+	case TopicReset:
+		b.mu.Lock()
+		b.counter = make(map[string]int)
+		b.mu.Unlock()
+		out.Emit(TopicResetDone)
+	case TopicCounters:
+		counter := b.counters()
+		if evt.IsRequest() {
+			return evt.Reply(TopicCountersDone, counter)
+		}
+		return out.Emit(TopicCountersDone, counter)
+	default:
+		incrs, err := b.eval(evt)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		for _, incr := range incrs {
+			b.counter[incr]++
+		}
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// counters returns a copy of the counters.
+func (b *Behavior) counters() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counter := make(map[string]int, len(b.counter))
+	for key, value := range b.counter {
+		counter[key] = value
+	}
+	return counter
+}
+
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "counter"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a counter behavior counting the topics of the events.
+// The optional parameter "topics" contains patterns for the topics to
+// count, by default all are counted.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	return New(func(evt *mesh.Event) ([]string, error) {
+		if mesh.MatchTopics(patterns, evt.Topic()) {
+			return []string{evt.Topic()}, nil
+		}
+		return nil, nil
+	}), nil
+}
+
 // EOF
@@ -12,6 +12,7 @@ package counter_test // import "tideland.dev/go/cells/behaviors/counter"
 //--------------------
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -79,4 +80,63 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestRequest tests the retrieval of the counters via request.
+func TestRequest(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	counteval := func(evt *mesh.Event) ([]string, error) {
+		return []string{evt.Topic()}, nil
+	}
+	msh := mesh.New(ctx)
+	msh.Go("counter", counter.New(counteval))
+
+	msh.Emit("counter", "a")
+	msh.Emit("counter", "b")
+	msh.Emit("counter", "a")
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "counter", counter.TopicCounters)
+	assert.NoError(err)
+	assert.Equal(reply.Topic(), counter.TopicCountersDone)
+	var counters map[string]int
+	assert.NoError(reply.Payload(&counters))
+	assert.Equal(counters, map[string]int{"a": 2, "b": 1})
+}
+
+// TestSnapshot tests keeping the counters across meshes via snapshots.
+func TestSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	counteval := func(evt *mesh.Event) ([]string, error) {
+		return []string{evt.Topic()}, nil
+	}
+	store, err := mesh.NewFileSnapshotStore(t.TempDir())
+	assert.NoError(err)
+
+	msh := mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	assert.NoError(msh.Go("counter", counter.New(counteval)))
+	msh.Emit("counter", "a")
+	msh.Emit("counter", "b")
+	msh.Emit("counter", "a")
+	assert.NoError(msh.Shutdown(ctx))
+
+	msh = mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	assert.NoError(msh.Go("counter", counter.New(counteval)))
+	msh.Emit("counter", "b")
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "counter", counter.TopicCounters)
+	assert.NoError(err)
+	var counters map[string]int
+	assert.NoError(reply.Payload(&counters))
+	assert.Equal(counters, map[string]int{"a": 2, "b": 2})
+
+	behavior := counter.New(counteval)
+	assert.ErrorContains(behavior.Restore([]byte("{broken")), "invalid character")
+}
+
 // EOF
@@ -12,7 +12,10 @@ package evaluator // import "tideland.dev/go/cells/behaviors/evaluator"
 //--------------------
 
 import (
+	"encoding/json"
+	"fmt"
 	"sort"
+	"sync"
 
 	"tideland.dev/go/cells/mesh"
 )
@@ -35,6 +38,10 @@ const (
 // EvaluationFunc is a function returning a rating for each received event.
 type EvaluationFunc func(evt *mesh.Event) (float64, error)
 
+// TypedEvaluationFunc is a function returning a rating for the decoded
+// payload of each received event.
+type TypedEvaluationFunc[T any] func(payload T) (float64, error)
+
 // Evaluation contains the aggregated result of all evaluations.
 type Evaluation struct {
 	Count     int
@@ -50,8 +57,11 @@ type Evaluation struct {
 
 // Behavior evaluations each event using a given function, which returns
 // a rating. The behavior counts these, looks for minimum and maximum rate,
-// and calculates the average and the medium.
+// and calculates the average and the medium. The evaluation is emitted or
+// in case of a request replied. The ratings can be saved and restored as
+// snapshot.
 type Behavior struct {
+	mu            sync.Mutex
 	evaluate      EvaluationFunc
 	maxRatings    int
 	ratings       []float64
@@ -59,6 +69,7 @@ type Behavior struct {
 }
 
 var _ mesh.Behavior = (*Behavior)(nil)
+var _ mesh.Snapshotter = (*Behavior)(nil)
 
 // New creates a new instance with the given evaluator.
 func New(evaluate EvaluationFunc) *Behavior {
@@ -67,6 +78,18 @@ func New(evaluate EvaluationFunc) *Behavior {
 	}
 }
 
+// NewTyped creates an evaluator behavior rating the payloads of type T
+// of the received events.
+func NewTyped[T any](evaluate TypedEvaluationFunc[T]) *Behavior {
+	return New(func(evt *mesh.Event) (float64, error) {
+		payload, err := mesh.PayloadAs[T](evt)
+		if err != nil {
+			return 0.0, err
+		}
+		return evaluate(payload)
+	})
+}
+
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
 	for {
@@ -74,34 +97,70 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case <-cell.Context().Done():
 			return nil
 		case evt := <-in.Pull():
-			switch evt.Topic() {
-			case TopicReset:
-				b.maxRatings = 0
-				b.ratings = nil
-				b.sortedRatings = nil
-				out.Emit(TopicResetDone)
-			case TopicEvaluate:
-				evaluation := b.evaluateRatings()
-				out.Emit(TopicEvaluationDone, evaluation)
-			default:
-				rating, err := b.evaluate(evt)
-				if err != nil {
-					return err
-				}
-				b.ratings = append(b.ratings, rating)
-				if b.maxRatings > 0 && len(b.ratings) > b.maxRatings {
-					// Take care for size.
-					b.ratings = b.ratings[1:]
-				}
-				if len(b.sortedRatings) < len(b.ratings) {
-					// Let it grow up to the needed size.
-					b.sortedRatings = append(b.sortedRatings, 0.0)
-				}
+			if err := b.process(evt, out); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// Snapshot implements the mesh.Snapshotter interface.
+func (b *Behavior) Snapshot() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return json.Marshal(b.ratings)
+}
+
+// Restore implements the mesh.Snapshotter interface.
+func (b *Behavior) Restore(data []byte) error {
+	var ratings []float64
+	if err := json.Unmarshal(data, &ratings); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxRatings > 0 && len(ratings) > b.maxRatings {
+		ratings = ratings[len(ratings)-b.maxRatings:]
+	}
+	b.ratings = ratings
+	b.sortedRatings = make([]float64, len(ratings))
+	return nil
+}
+
+// process handles one received event.
+func (b *Behavior) process(evt *mesh.Event, out mesh.Emitter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch evt.Topic() {
+	case TopicReset:
+		b.maxRatings = 0
+		b.ratings = nil
+		b.sortedRatings = nil
+		out.Emit(TopicResetDone)
+	case TopicEvaluate:
+		evaluation := b.evaluateRatings()
+		if evt.IsRequest() {
+			return evt.Reply(TopicEvaluationDone, evaluation)
+		}
+		out.Emit(TopicEvaluationDone, evaluation)
+	default:
+		rating, err := b.evaluate(evt)
+		if err != nil {
+			return err
+		}
+		b.ratings = append(b.ratings, rating)
+		if b.maxRatings > 0 && len(b.ratings) > b.maxRatings {
+			// Take care for size.
+			b.ratings = b.ratings[1:]
+		}
+		if len(b.sortedRatings) < len(b.ratings) {
+			// Let it grow up to the needed size.
+			b.sortedRatings = append(b.sortedRatings, 0.0)
+		}
+	}
+	return nil
+}
+
 // evaluateRatings evaluates the collected ratings.
 func (b *Behavior) evaluateRatings() Evaluation {
 	var evaluation Evaluation
@@ -132,4 +191,47 @@ func (b *Behavior) evaluateRatings() Evaluation {
 	return evaluation
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "evaluator"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates an evaluator behavior using numeric payloads as rating.
+// For payloads which are objects "field" names the numeric field. The
+// optional parameter "max" limits the number of ratings.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	field, err := params.String("field", "")
+	if err != nil {
+		return nil, err
+	}
+	max, err := params.Int("max", 0)
+	if err != nil {
+		return nil, err
+	}
+	b := New(func(evt *mesh.Event) (float64, error) {
+		if field == "" {
+			return mesh.PayloadAs[float64](evt)
+		}
+		fields, err := mesh.PayloadAs[map[string]interface{}](evt)
+		if err != nil {
+			return 0.0, err
+		}
+		rating, ok := fields[field].(float64)
+		if !ok {
+			return 0.0, fmt.Errorf("payload field '%s' is not numeric", field)
+		}
+		return rating, nil
+	})
+	b.maxRatings = max
+	return b, nil
+}
+
 // EOF
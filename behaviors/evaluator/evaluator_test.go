@@ -12,6 +12,7 @@ package evaluator_test // import "tideland.dev/go/cells/behaviors/evaluator"
 //--------------------
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -67,6 +68,76 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestRequest verifies the retrieval of the evaluation via request.
+func TestRequest(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evaluateFunc := func(evt *mesh.Event) (float64, error) {
+		return float64(len(evt.Topic())), nil
+	}
+	msh := mesh.New(ctx)
+	msh.Go("evaluator", evaluator.New(evaluateFunc))
+
+	msh.Emit("evaluator", "a")
+	msh.Emit("evaluator", "bbb")
+	msh.Emit("evaluator", "cc")
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	reply, err := msh.Request(rctx, "evaluator", evaluator.TopicEvaluate)
+	assert.NoError(err)
+	assert.Equal(reply.Topic(), evaluator.TopicEvaluationDone)
+	var evaluation evaluator.Evaluation
+	assert.NoError(reply.Payload(&evaluation))
+	assert.Equal(evaluation.Count, 3)
+	assert.Equal(evaluation.MinRating, 1.0)
+	assert.Equal(evaluation.MaxRating, 3.0)
+	assert.Equal(evaluation.MedRating, 2.0)
+}
+
+// TestSnapshot verifies taking and restoring snapshots of the ratings.
+func TestSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evaluateFunc := func(evt *mesh.Event) (float64, error) {
+		return float64(len(evt.Topic())), nil
+	}
+	evaluate := func(msh mesh.Mesh) evaluator.Evaluation {
+		rctx, rcancel := context.WithTimeout(ctx, time.Second)
+		defer rcancel()
+		reply, err := msh.Request(rctx, "evaluator", evaluator.TopicEvaluate)
+		assert.NoError(err)
+		var evaluation evaluator.Evaluation
+		assert.NoError(reply.Payload(&evaluation))
+		return evaluation
+	}
+	store, err := mesh.NewFileSnapshotStore(t.TempDir())
+	assert.NoError(err)
+
+	msh := mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	msh.Go("evaluator", evaluator.New(evaluateFunc))
+	msh.Emit("evaluator", "a")
+	msh.Emit("evaluator", "bbb")
+	msh.Emit("evaluator", "cc")
+	assert.Equal(evaluate(msh).Count, 3)
+	assert.NoError(msh.Snapshot())
+	msh.Emit("evaluator", "dddd")
+	assert.Equal(evaluate(msh).Count, 4)
+
+	// Restoring a running cell.
+	assert.NoError(msh.Restore())
+	evaluation := evaluate(msh)
+	assert.Equal(evaluation.Count, 3)
+	assert.Equal(evaluation.MaxRating, 3.0)
+
+	// Without store no snapshots.
+	msh = mesh.New(ctx)
+	assert.ErrorContains(msh.Snapshot(), "no snapshot store configured")
+	assert.ErrorContains(msh.Restore(), "no snapshot store configured")
+}
+
 // TestFail verifies the wanted failing of the evaluation.
 func TestFail(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -97,4 +168,32 @@ func TestFail(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestTyped verifies the evaluation of typed payloads.
+func TestTyped(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior := evaluator.NewTyped(func(value float64) (float64, error) {
+		return value * 2, nil
+	})
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.AssertRetry(func() bool { return tbe.Len() == 1 }, "evaluation not yet emitted")
+			evt, ok := tbe.First()
+			tbe.Assert(ok, "evaluation event missing")
+			evaluation, err := mesh.PayloadAs[evaluator.Evaluation](evt)
+			tbe.Assert(err == nil, "payload error not nil: %v", err)
+			tbe.Assert(evaluation.Count == 3, "evaluation count not 3: %v", evaluation.Count)
+			tbe.Assert(evaluation.MaxRating == 6.0, "evaluation max rating not 6.0: %v", evaluation.MaxRating)
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		out.Emit("value", 1.0)
+		out.Emit("value", 2.0)
+		out.Emit("value", 3.0)
+		out.Emit(evaluator.TopicEvaluate)
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -12,6 +12,9 @@ package filter // import "tideland.dev/go/cells/behaviors/filter"
 //--------------------
 
 import (
+	"errors"
+	"fmt"
+
 	"tideland.dev/go/cells/mesh"
 )
 
@@ -33,6 +36,10 @@ const (
 // FilterFunc defines how events are filtered for including or excluding.
 type FilterFunc func(event *mesh.Event) (bool, error)
 
+// TypedFilterFunc defines how events are filtered based on their decoded
+// payloads.
+type TypedFilterFunc[T any] func(payload T) (bool, error)
+
 // mode describes if the filter works including or excluding.
 type mode int
 
@@ -74,6 +81,29 @@ func NewExcluding(filter FilterFunc) *Behavior {
 	}
 }
 
+// NewTypedIncluding creates a filter behavior only emitting events whose
+// payloads of type T pass the filter function.
+func NewTypedIncluding[T any](filter TypedFilterFunc[T]) *Behavior {
+	return NewIncluding(typedFilter(filter))
+}
+
+// NewTypedExcluding creates a filter behavior only emitting events whose
+// payloads of type T don't pass the filter function.
+func NewTypedExcluding[T any](filter TypedFilterFunc[T]) *Behavior {
+	return NewExcluding(typedFilter(filter))
+}
+
+// typedFilter wraps a typed filter function into a FilterFunc.
+func typedFilter[T any](filter TypedFilterFunc[T]) FilterFunc {
+	return func(evt *mesh.Event) (bool, error) {
+		payload, err := mesh.PayloadAs[T](evt)
+		if err != nil {
+			return false, err
+		}
+		return filter(payload)
+	}
+}
+
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
 	for {
@@ -99,4 +129,47 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "filter"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a filter behavior for events whose topics match one of
+// the patterns of the parameter "topics". The parameter "mode" is
+// "including" (default) or "excluding".
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	filter := func(evt *mesh.Event) (bool, error) {
+		return mesh.MatchTopics(patterns, evt.Topic()), nil
+	}
+	mode, err := params.String("mode", "including")
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case "including":
+		return NewIncluding(filter), nil
+	case "excluding":
+		return NewExcluding(filter), nil
+	}
+	return nil, fmt.Errorf("invalid mode '%s'", mode)
+}
+
 // EOF
@@ -82,4 +82,87 @@ func TestExcludingSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestHeaders verifies that filtered events keep their headers.
+func TestHeaders(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	filterFunc := func(evt *mesh.Event) (bool, error) {
+		tenant, _ := evt.Header("tenant")
+		return tenant == "acme", nil
+	}
+	behavior := filter.NewIncluding(filterFunc)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.AssertRetry(func() bool { return tbe.Len() == 2 }, "filtered events not 2: %v", tbe)
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				tbe.Assert(evt.Headers()["schema"] == "v2", "header of event %d lost: %v", i, evt)
+				return nil
+			})
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		out.Emit("one", mesh.WithHeaders(map[string]string{"tenant": "acme", "schema": "v2"}))
+		out.Emit("two", mesh.WithHeader("tenant", "other"))
+		out.Emit("three", mesh.WithHeaders(map[string]string{"tenant": "acme", "schema": "v2"}))
+	}, time.Second)
+	assert.NoError(err)
+}
+
+// TestTyped verifies filtering of typed payloads.
+func TestTyped(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior := filter.NewTypedIncluding(func(value int) (bool, error) {
+		return value%2 == 0, nil
+	})
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.AssertRetry(func() bool { return tbe.Len() == 5 }, "filtered events not 5: %v", tbe)
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				value, err := mesh.PayloadAs[int](evt)
+				tbe.Assert(err == nil && value%2 == 0, "event %d not filtered: %v", i, evt)
+				return nil
+			})
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		for i := 0; i < 10; i++ {
+			out.Emit("value", i)
+		}
+	}, time.Second)
+	assert.NoError(err)
+}
+
+// TestFactory verifies the creation of filters by the registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	registry := mesh.DefaultBehaviorRegistry()
+	_, err := registry.Create(filter.Kind, mesh.BehaviorParams{"topics": "a", "mode": "sideways"})
+	assert.ErrorContains(err, "invalid mode 'sideways'")
+	behavior, err := registry.Create(filter.Kind, mesh.BehaviorParams{
+		"topics": []interface{}{"alarm.*"},
+		"mode":   "excluding",
+	})
+	assert.NoError(err)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.AssertRetry(func() bool { return tbe.Len() == 2 }, "filtered events not 2: %v", tbe)
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				tbe.Assert(evt.Topic() == "info", "event %d not filtered: %v", i, evt)
+				return nil
+			})
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		out.Emit("info")
+		out.Emit("alarm.fire")
+		out.Emit("info")
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
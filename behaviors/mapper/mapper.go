@@ -22,6 +22,11 @@ import (
 // MapperFunc defines how incoming events are to map into outcomming event.
 type MapperFunc func(evt *mesh.Event) (*mesh.Event, error)
 
+// TypedMapperFunc maps the topic and the decoded payload of an incoming
+// event into topic and payload of the outgoing event. An empty topic
+// drops the event.
+type TypedMapperFunc[T, U any] func(topic string, payload T) (string, U, error)
+
 //--------------------
 // BEHAVIOR
 //--------------------
@@ -41,6 +46,27 @@ func New(mapper MapperFunc) *Behavior {
 	}
 }
 
+// NewTyped creates a new instance of the mapper behavior mapping payloads
+// of type T into payloads of type U. The mapped events keep the headers,
+// the correlation ID, and the codec of the incoming ones.
+func NewTyped[T, U any](mapper TypedMapperFunc[T, U]) *Behavior {
+	return New(func(evt *mesh.Event) (*mesh.Event, error) {
+		payload, err := mesh.PayloadAs[T](evt)
+		if err != nil {
+			return nil, err
+		}
+		topic, mapped, err := mapper(evt.Topic(), payload)
+		if err != nil || topic == "" {
+			return nil, err
+		}
+		return mesh.NewTypedEvent(topic, mapped,
+			mesh.WithHeaders(evt.Headers()),
+			mesh.WithCorrelationID(evt.CorrelationID()),
+			mesh.WithCodec(evt.Codec()),
+		)
+	})
+}
+
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
 	for {
@@ -59,4 +85,34 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "mapper"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a mapper behavior renaming the topics of events
+// based on the parameter "topics", a map of old to new topics. Events
+// with other topics are passed unchanged.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	topics, err := params.StringMap("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	return New(func(evt *mesh.Event) (*mesh.Event, error) {
+		topic, ok := topics[evt.Topic()]
+		if !ok {
+			return evt, nil
+		}
+		return evt.Derive(topic)
+	}), nil
+}
+
 // EOF
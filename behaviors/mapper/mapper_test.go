@@ -65,4 +65,66 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestTyped verifies mapping of typed payloads.
+func TestTyped(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	mapperFunc := func(topic string, word string) (string, int, error) {
+		if word == "" {
+			return "", 0, nil
+		}
+		return "length", len(word), nil
+	}
+	behavior := mapper.NewTyped(mapperFunc)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 2 })
+			tbe.Do(func(i int, evt *mesh.Event) error {
+				l, err := mesh.PayloadAs[int](evt)
+				tbe.Assert(err == nil, "error accessing payload: %v", err)
+				tbe.Assert(evt.Topic() == "length", "topic %d not mapped: %v", i, evt)
+				tbe.Assert(l == 3+i, "payload %d not mapped: %v", i, l)
+				tenant, _ := evt.Header("tenant")
+				tbe.Assert(tenant == "acme", "header %d not kept: %v", i, evt)
+				return nil
+			})
+		},
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		out.Emit("word", "foo", mesh.WithHeader("tenant", "acme"))
+		out.Emit("word", "", mesh.WithHeader("tenant", "acme"))
+		out.Emit("word", "barz", mesh.WithHeader("tenant", "acme"))
+	}, time.Second)
+	assert.NoError(err)
+}
+
+// TestFactory verifies the creation of topic renaming mappers by the
+// registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior, err := mesh.DefaultBehaviorRegistry().Create(mapper.Kind, mesh.BehaviorParams{
+		"topics": map[string]interface{}{"temp": "temperature"},
+	})
+	assert.NoError(err)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 2 })
+			evt, _ := tbe.First()
+			value, err := mesh.PayloadAs[float64](evt)
+			tbe.Assert(evt.Topic() == "temperature", "topic not renamed: %v", evt)
+			tbe.Assert(err == nil && value == 21.5, "payload not kept: %v", evt)
+			evt, _ = tbe.Last()
+			tbe.Assert(evt.Topic() == "humidity", "topic renamed: %v", evt)
+		},
+	)
+	err = tb.Go(func(out mesh.Emitter) {
+		out.Emit("temp", 21.5)
+		out.Emit("humidity", 60)
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -58,4 +58,37 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "onetimer"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a one-timer behavior re-emitting only the first
+// received event. If the parameter "topic" is set it is emitted with
+// that topic.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	topic, err := params.String("topic", "")
+	if err != nil {
+		return nil, err
+	}
+	return New(func(evt *mesh.Event, out mesh.Emitter) error {
+		if topic == "" {
+			return out.EmitEvent(evt)
+		}
+		derived, err := evt.Derive(topic)
+		if err != nil {
+			return err
+		}
+		return out.EmitEvent(derived)
+	}), nil
+}
+
 // EOF
@@ -12,6 +12,7 @@ package pairer // import "tideland.dev/go/cells/behaviors/pairer"
 //--------------------
 
 import (
+	"errors"
 	"time"
 
 	"tideland.dev/go/cells/mesh"
@@ -66,7 +67,7 @@ func New(pairer PairerFunc, duration time.Duration) *Behavior {
 
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
-	var ticker *time.Ticker
+	var ticker mesh.Ticker
 	quitec := make(<-chan time.Time)
 	tickc := quitec
 	for {
@@ -80,8 +81,8 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 			if b.hit == nil {
 				// First hit resets ticker.
 				b.hit = evt
-				ticker = time.NewTicker(b.duration)
-				tickc = ticker.C
+				ticker = cell.Clock().NewTicker(b.duration)
+				tickc = ticker.C()
 				continue
 			}
 			// Second hit.
@@ -101,4 +102,42 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "pairer"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a pairer behavior pairing events whose topics match
+// one of the patterns of the parameter "topics" within "duration".
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	duration, err := params.Duration("duration", 0)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, errors.New("parameter 'duration' has to be positive")
+	}
+	return New(func(fstEvt, sndEvt *mesh.Event) bool {
+		return mesh.MatchTopics(patterns, sndEvt.Topic())
+	}, duration), nil
+}
+
 // EOF
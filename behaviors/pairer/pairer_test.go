@@ -75,6 +75,7 @@ func TestFailOneHit(t *testing.T) {
 		}
 		return false
 	}
+	clock := mesh.NewManualClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
 	behavior := pairer.New(pairerFunc, 10*time.Millisecond)
 	// Run tests.
 	tb := mesh.NewTestbed(
@@ -86,12 +87,15 @@ func TestFailOneHit(t *testing.T) {
 				return nil
 			})
 		},
+		mesh.WithClock(clock),
 	)
 	err := tb.Go(func(out mesh.Emitter) {
 		for i := 0; i < 1000; i++ {
 			topic := generator.LimitedWord(4, 5)
 			out.Emit(topic)
 		}
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Millisecond)
 	}, time.Second)
 	assert.NoError(err)
 }
@@ -121,4 +125,45 @@ func TestFailNoHit(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestTimeout verifies the timeout after a first hit using a manual
+// clock.
+func TestTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	clock := mesh.NewManualClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	pairerFunc := func(fstEvt, sndEvt *mesh.Event) bool {
+		return sndEvt.Topic() == "hit"
+	}
+	behavior := pairer.New(pairerFunc, time.Minute)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 2 })
+			first, _ := tbe.First()
+			tbe.Assert(first.Topic() == pairer.TopicMatch, "first is no match: %v", first)
+			var pair pairer.Pair
+			err := first.Payload(&pair)
+			tbe.Assert(err == nil, "error retrieving the pair event payload: %v", err)
+			distance := pair.Second.Timestamp().Sub(pair.First.Timestamp())
+			tbe.Assert(distance == 59*time.Second, "invalid distance of the pair: %v", distance)
+			last, _ := tbe.Last()
+			tbe.Assert(last.Topic() == pairer.TopicTimeout, "last is no timeout: %v", last)
+		},
+		mesh.WithClock(clock),
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		// Pair within the duration.
+		out.Emit("hit")
+		clock.BlockUntil(1)
+		clock.Advance(59 * time.Second)
+		out.Emit("miss")
+		out.Emit("hit")
+		// Timeout after first hit.
+		out.Emit("hit")
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -12,6 +12,7 @@ package rateevaluator // import "tideland.dev/go/cells/behaviors/rateevaluator"
 //--------------------
 
 import (
+	"errors"
 	"time"
 
 	"tideland.dev/go/cells/mesh"
@@ -69,7 +70,7 @@ func New(matches RaterFunc, count int) *Behavior {
 
 // Go implements the mesh.Behavior interface.
 func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
-	last := time.Now()
+	last := cell.Clock().Now()
 	countMatching := 0
 	countNonMatching := 0
 	durations := []time.Duration{}
@@ -80,7 +81,7 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 		case evt := <-in.Pull():
 			switch evt.Topic() {
 			case TopicReset:
-				last = time.Now()
+				last = cell.Clock().Now()
 				countMatching = 0
 				countNonMatching = 0
 				durations = []time.Duration{}
@@ -129,4 +130,43 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	}
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "rateevaluator"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a rate evaluator behavior for events whose topics
+// match one of the patterns of the parameter "topics". The parameter
+// "count" sets the number of durations the rate is calculated of.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	count, err := params.Int("count", 10)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		return nil, errors.New("parameter 'count' has to be positive")
+	}
+	return New(func(evt *mesh.Event) (bool, error) {
+		return mesh.MatchTopics(patterns, evt.Topic()), nil
+	}, count), nil
+}
+
 // EOF
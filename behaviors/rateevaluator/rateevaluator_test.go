@@ -60,4 +60,41 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestDurations verifies the calculated durations between matching
+// events using a manual clock.
+func TestDurations(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	clock := mesh.NewManualClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	raterFunc := func(evt *mesh.Event) (bool, error) {
+		return evt.Topic() == "match", nil
+	}
+	behavior := rateevaluator.New(raterFunc, 2)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 3 })
+			last, _ := tbe.Last()
+			var rate rateevaluator.Rate
+			err := last.Payload(&rate)
+			tbe.Assert(err == nil, "payload is no rate: %v", err)
+			tbe.Assert(rate.CountMatching == 3, "invalid count match: %d", rate.CountMatching)
+			tbe.Assert(rate.CountNonMatching == 3, "invalid count non-match: %d", rate.CountNonMatching)
+			tbe.Assert(rate.Duration == 3*time.Second, "invalid duration: %v", rate.Duration)
+			tbe.Assert(rate.Low == 2*time.Second, "invalid low: %v", rate.Low)
+			tbe.Assert(rate.High == 3*time.Second, "invalid high: %v", rate.High)
+			tbe.Assert(rate.Average == 2500*time.Millisecond, "invalid average: %v", rate.Average)
+		},
+		mesh.WithClock(clock),
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		for _, d := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+			clock.Advance(d)
+			out.Emit("no-match")
+			out.Emit("match")
+		}
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
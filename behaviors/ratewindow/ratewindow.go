@@ -12,6 +12,7 @@ package ratewindow // import "tideland.dev/go/cells/behaviors/ratewindow"
 //--------------------
 
 import (
+	"errors"
 	"time"
 
 	"tideland.dev/go/cells/mesh"
@@ -111,4 +112,52 @@ func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error
 	return nil
 }
 
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "ratewindow"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a rate window behavior for events whose topics match
+// one of the patterns of the parameter "topics". If "count" of them are
+// received within "duration" the number of events is emitted.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	patterns, err := params.Strings("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("parameter 'topics' is missing")
+	}
+	if err := mesh.ValidateTopicPatterns(patterns); err != nil {
+		return nil, err
+	}
+	count, err := params.Int("count", 0)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		return nil, errors.New("parameter 'count' has to be positive")
+	}
+	duration, err := params.Duration("duration", 0)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, errors.New("parameter 'duration' has to be positive")
+	}
+	return New(func(evt *mesh.Event) (bool, error) {
+		return mesh.MatchTopics(patterns, evt.Topic()), nil
+	}, count, duration, func(r mesh.EventSinkReader) (interface{}, error) {
+		return r.Len(), nil
+	}), nil
+}
+
 // EOF
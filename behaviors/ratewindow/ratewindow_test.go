@@ -75,4 +75,45 @@ func TestSuccess(t *testing.T) {
 	assert.NoError(err)
 }
 
+// TestWindow verifies the detection of rate windows with event
+// timestamps of a manual clock.
+func TestWindow(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	clock := mesh.NewManualClock(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	matcher := func(evt *mesh.Event) (bool, error) {
+		return evt.Topic() == "match", nil
+	}
+	processor := func(reader mesh.EventSinkReader) (interface{}, error) {
+		first, _ := reader.First()
+		return first.Timestamp(), nil
+	}
+	behavior := ratewindow.New(matcher, 3, time.Second, processor)
+	// Run tests.
+	tb := mesh.NewTestbed(
+		behavior,
+		func(tbe *mesh.TestbedEvaluator) {
+			tbe.WaitFor(func() bool { return tbe.Len() == 1 })
+			evt, _ := tbe.First()
+			var first time.Time
+			err := evt.Payload(&first)
+			tbe.Assert(err == nil, "payload is no time: %v", err)
+			tbe.Assert(first.Equal(clock.Now().Add(-time.Second)), "invalid window start: %v", first)
+		},
+		mesh.WithClock(clock),
+	)
+	err := tb.Go(func(out mesh.Emitter) {
+		// Too slow.
+		for i := 0; i < 3; i++ {
+			out.Emit("match")
+			clock.Advance(600 * time.Millisecond)
+		}
+		// Fast enough.
+		for i := 0; i < 3; i++ {
+			clock.Advance(500 * time.Millisecond)
+			out.Emit("match")
+		}
+	}, time.Second)
+	assert.NoError(err)
+}
+
 // EOF
@@ -0,0 +1,245 @@
+// Tideland Go Cells - Behaviors - Router
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package router // import "tideland.dev/go/cells/behaviors/router"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// TopicRouteError is emitted when an event cannot be routed.
+const TopicRouteError = "route-error"
+
+//--------------------
+// HELPER
+//--------------------
+
+// KeyFunc returns the name of the target cell for an event. An empty
+// name lets the router continue with the topic and pattern routes.
+type KeyFunc func(evt *mesh.Event) (string, error)
+
+// PayloadRouteError is the payload of the events sent to the error
+// route if an event could not be routed.
+type PayloadRouteError struct {
+	Event  *mesh.Event `json:"event"`
+	Target string      `json:"target,omitempty"`
+	Reason string      `json:"reason"`
+}
+
+// patternRoute routes the events whose topics match the pattern.
+type patternRoute struct {
+	pattern string
+	target  string
+}
+
+// Option defines the routes of the router.
+type Option func(b *Behavior)
+
+// WithTopic routes the events with the topic to the target cell.
+func WithTopic(topic, target string) Option {
+	return func(b *Behavior) {
+		b.topics[topic] = target
+	}
+}
+
+// WithPattern routes the events whose topics match the pattern to the
+// target cell. Patterns are checked in the order they are added and
+// after the topics. Invalid patterns don't match any topic, they can
+// be checked with mesh.ValidateTopicPattern().
+func WithPattern(pattern, target string) Option {
+	return func(b *Behavior) {
+		b.patterns = append(b.patterns, patternRoute{
+			pattern: pattern,
+			target:  target,
+		})
+	}
+}
+
+// WithKey lets the key function choose the target cell. It is
+// asked before the topics and patterns.
+func WithKey(key KeyFunc) Option {
+	return func(b *Behavior) {
+		b.key = key
+	}
+}
+
+// WithDefault routes all events without a matching route to the
+// target cell.
+func WithDefault(target string) Option {
+	return func(b *Behavior) {
+		b.defaultTarget = target
+	}
+}
+
+// WithErrorRoute sends an event with the topic TopicRouteError to
+// the target cell for each event which could not be routed. Without
+// it those events are only logged.
+func WithErrorRoute(target string) Option {
+	return func(b *Behavior) {
+		b.errorTarget = target
+	}
+}
+
+//--------------------
+// BEHAVIOR
+//--------------------
+
+// Behavior provides a behavior forwarding each received event to one
+// of several named target cells. It emits the events directly via the
+// mesh of its cell, so the targets don't need to be subscribed.
+type Behavior struct {
+	topics        map[string]string
+	patterns      []patternRoute
+	key           KeyFunc
+	defaultTarget string
+	errorTarget   string
+}
+
+var _ mesh.Behavior = (*Behavior)(nil)
+
+// New creates a router behavior with the given routes.
+func New(options ...Option) *Behavior {
+	b := &Behavior{
+		topics: make(map[string]string),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Go implements the mesh.Behavior interface.
+func (b *Behavior) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			target, err := b.route(evt)
+			if err == nil {
+				err = cell.Mesh().EmitEvent(target, evt)
+			}
+			if err != nil {
+				b.fail(cell, evt, target, err)
+			}
+		}
+	}
+}
+
+// route returns the target cell for the event.
+func (b *Behavior) route(evt *mesh.Event) (string, error) {
+	if b.key != nil {
+		target, err := b.key(evt)
+		if err != nil {
+			return "", err
+		}
+		if target != "" {
+			return target, nil
+		}
+	}
+	if target, ok := b.topics[evt.Topic()]; ok {
+		return target, nil
+	}
+	for _, pr := range b.patterns {
+		if mesh.MatchTopic(pr.pattern, evt.Topic()) {
+			return pr.target, nil
+		}
+	}
+	if b.defaultTarget != "" {
+		return b.defaultTarget, nil
+	}
+	return "", fmt.Errorf("no route for topic '%s'", evt.Topic())
+}
+
+// fail handles an event which could not be routed.
+func (b *Behavior) fail(cell mesh.Cell, evt *mesh.Event, target string, err error) {
+	cell.Logger().Warn("event not routed", "topic", evt.Topic(), "target", target, "error", err)
+	if b.errorTarget == "" {
+		return
+	}
+	errEvt, nerr := mesh.NewEvent(TopicRouteError, mesh.WithTimestamp(cell.Clock().Now()), PayloadRouteError{
+		Event:  evt,
+		Target: target,
+		Reason: err.Error(),
+	})
+	if nerr == nil {
+		nerr = cell.Mesh().EmitEvent(b.errorTarget, errEvt)
+	}
+	if nerr != nil {
+		cell.Logger().Error("cannot send route error", "target", b.errorTarget, "error", nerr)
+	}
+}
+
+//--------------------
+// FACTORY
+//--------------------
+
+// Kind is the name the behavior is registered with at the default
+// behavior registry.
+const Kind = "router"
+
+// init registers the behavior factory.
+func init() {
+	mesh.RegisterBehavior(Kind, Factory)
+}
+
+// Factory creates a router behavior. The parameter "topics" maps topics
+// and the parameter "patterns" topic patterns to target cells, patterns
+// are checked in their sorted order. The parameters "default" and
+// "error" name the default and the error route.
+func Factory(params mesh.BehaviorParams) (mesh.Behavior, error) {
+	topics, err := params.StringMap("topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := params.StringMap("patterns", nil)
+	if err != nil {
+		return nil, err
+	}
+	defaultTarget, err := params.String("default", "")
+	if err != nil {
+		return nil, err
+	}
+	errorTarget, err := params.String("error", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 && len(patterns) == 0 && defaultTarget == "" {
+		return nil, errors.New("parameters 'topics', 'patterns', or 'default' are missing")
+	}
+	var options []Option
+	for topic, target := range topics {
+		options = append(options, WithTopic(topic, target))
+	}
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keys = append(keys, pattern)
+	}
+	sort.Strings(keys)
+	if err := mesh.ValidateTopicPatterns(keys); err != nil {
+		return nil, err
+	}
+	for _, pattern := range keys {
+		options = append(options, WithPattern(pattern, patterns[pattern]))
+	}
+	options = append(options, WithDefault(defaultTarget), WithErrorRoute(errorTarget))
+	return New(options...), nil
+}
+
+// EOF
@@ -0,0 +1,182 @@
+// Tideland Go Cells - Behaviors - Router - Unit Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package router_test // import "tideland.dev/go/cells/behaviors/router"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/behaviors/router"
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestRoutes verifies the routing by topics, patterns, and default.
+func TestRoutes(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	behavior := router.New(
+		router.WithTopic("order", "orders"),
+		router.WithPattern("sensor.*", "sensors"),
+		router.WithPattern("**", "all"),
+		router.WithDefault("others"),
+	)
+	itb := newTestbed(assert, behavior, "orders", "sensors", "all", "others")
+	defer itb.Stop()
+
+	assert.NoError(itb.Emit("router", "order"))
+	assert.NoError(itb.Emit("router", "sensor.temp"))
+	assert.NoError(itb.Emit("router", "sensor.humidity"))
+	assert.NoError(itb.Emit("router", "anything"))
+	assert.NoError(itb.WaitForTopics("orders", []string{"order"}, time.Second))
+	assert.NoError(itb.WaitForTopics("sensors", []string{"sensor.temp", "sensor.humidity"}, time.Second))
+	evt, err := itb.WaitForTopic("all", "anything", time.Second)
+	assert.NoError(err)
+	assert.Equal(evt.Emitters(), "/router/all")
+
+	topics, err := itb.Topics("others")
+	assert.NoError(err)
+	assert.Length(topics, 0)
+}
+
+// TestKeyRoutes verifies the routing by a key function.
+func TestKeyRoutes(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	key := func(evt *mesh.Event) (string, error) {
+		var target string
+		if !evt.HasPayload() {
+			return "", nil
+		}
+		err := evt.Payload(&target)
+		return target, err
+	}
+	behavior := router.New(
+		router.WithKey(key),
+		router.WithTopic("order", "orders"),
+	)
+	itb := newTestbed(assert, behavior, "orders", "a", "b")
+	defer itb.Stop()
+
+	assert.NoError(itb.Emit("router", "order", "a"))
+	assert.NoError(itb.Emit("router", "order", "b"))
+	assert.NoError(itb.Emit("router", "order"))
+	assert.NoError(itb.WaitForTopics("a", []string{"order"}, time.Second))
+	assert.NoError(itb.WaitForTopics("b", []string{"order"}, time.Second))
+	assert.NoError(itb.WaitForTopics("orders", []string{"order"}, time.Second))
+}
+
+// TestErrorRoute verifies the error route for events without a route,
+// failing key functions, and unknown targets.
+func TestErrorRoute(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	key := func(evt *mesh.Event) (string, error) {
+		if evt.Topic() == "fail" {
+			return "", errors.New("ouch")
+		}
+		return "", nil
+	}
+	behavior := router.New(
+		router.WithKey(key),
+		router.WithTopic("lost", "unknown"),
+		router.WithErrorRoute("errors"),
+	)
+	itb := newTestbed(assert, behavior, "errors")
+	defer itb.Stop()
+
+	assert.NoError(itb.Emit("router", "nowhere"))
+	assert.NoError(itb.Emit("router", "fail"))
+	assert.NoError(itb.Emit("router", "lost"))
+	assert.NoError(itb.WaitForTopics("errors", []string{
+		router.TopicRouteError, router.TopicRouteError, router.TopicRouteError,
+	}, time.Second))
+	sink, err := itb.Captured("errors")
+	assert.NoError(err)
+	reasons := []string{
+		"no route for topic 'nowhere'",
+		"ouch",
+		"cell 'unknown' does not exist",
+	}
+	i := 0
+	assert.NoError(sink.Do(func(_ int, evt *mesh.Event) error {
+		var payload router.PayloadRouteError
+		assert.NoError(evt.Payload(&payload))
+		assert.Equal(payload.Reason, reasons[i])
+		assert.NotNil(payload.Event)
+		i++
+		return nil
+	}))
+	assert.Equal(i, 3)
+}
+
+// TestFactory verifies the creation of routers by the registry.
+func TestFactory(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	_, err := mesh.DefaultBehaviorRegistry().Create(router.Kind, mesh.BehaviorParams{})
+	assert.ErrorContains(err, "parameters 'topics', 'patterns', or 'default' are missing")
+	_, err = mesh.DefaultBehaviorRegistry().Create(router.Kind, mesh.BehaviorParams{
+		"patterns": map[string]interface{}{"sensor.[": "x"},
+	})
+	assert.ErrorContains(err, "invalid topic pattern 'sensor.['")
+
+	behavior, err := mesh.DefaultBehaviorRegistry().Create(router.Kind, mesh.BehaviorParams{
+		"topics":   map[string]interface{}{"order": "orders"},
+		"patterns": map[string]interface{}{"sensor.*": "sensors"},
+		"default":  "others",
+	})
+	assert.NoError(err)
+	itb := newTestbed(assert, behavior, "orders", "sensors", "others")
+	defer itb.Stop()
+
+	assert.NoError(itb.Emit("router", "order"))
+	assert.NoError(itb.Emit("router", "sensor.temp"))
+	assert.NoError(itb.Emit("router", "anything"))
+	assert.NoError(itb.WaitForTopics("orders", []string{"order"}, time.Second))
+	assert.NoError(itb.WaitForTopics("sensors", []string{"sensor.temp"}, time.Second))
+	assert.NoError(itb.WaitForTopics("others", []string{"anything"}, time.Second))
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// newTestbed starts the router and forwarding target cells whose
+// events are captured.
+func newTestbed(assert *asserts.Asserts, behavior mesh.Behavior, targets ...string) *mesh.IntegrationTestbed {
+	itb := mesh.NewIntegrationTestbed()
+	assert.NoError(itb.Go("router", behavior))
+	for _, target := range targets {
+		assert.NoError(itb.Go(target, mesh.BehaviorFunc(forwardFunc)))
+	}
+	assert.NoError(itb.Capture(targets...))
+	return itb
+}
+
+// forwardFunc re-emits all received events.
+func forwardFunc(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			if err := out.EmitEvent(evt); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EOF
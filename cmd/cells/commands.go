@@ -0,0 +1,338 @@
+// Tideland Go Cells - Commands - Cells
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package main // import "tideland.dev/go/cells/cmd/cells"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/recording"
+	"tideland.dev/go/cells/topology"
+)
+
+//--------------------
+// COMMAND
+//--------------------
+
+// command is one of the commands of the tool.
+type command interface {
+	// flags returns the flag set of the command.
+	flags() *flag.FlagSet
+
+	// execute runs the command after the flags are parsed.
+	execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// maxLineSize limits the size of one line of input.
+const maxLineSize = 16 * 1024 * 1024
+
+//--------------------
+// MESH COMMAND
+//--------------------
+
+// meshCommand contains the flags and the handling shared by the
+// commands running a mesh.
+type meshCommand struct {
+	topology string
+	input    string
+	print    string
+	wait     time.Duration
+	timeout  time.Duration
+	graph    string
+}
+
+// addFlags adds the shared flags to the flag set.
+func (c *meshCommand) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.topology, "topology", "", "topology file in JSON or YAML (required)")
+	fs.StringVar(&c.input, "input", "", "name of the cell receiving the events, replays default to the recorded cells")
+	fs.StringVar(&c.print, "print", "", "comma separated names of the cells whose emitted events are printed")
+	fs.DurationVar(&c.wait, "wait", 0, "time to wait after the input before shutting down")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Second, "maximum time for shutting down the mesh")
+	fs.StringVar(&c.graph, "graph", "", "write the graph of the running mesh as 'dot' or 'mermaid' to stderr")
+}
+
+// start builds the mesh out of the topology and adds the printing
+// cells.
+func (c *meshCommand) start(ctx context.Context, stdout io.Writer) (mesh.Mesh, error) {
+	if c.topology == "" {
+		return nil, errors.New("flag -topology is required")
+	}
+	if c.graph != "" && c.graph != "dot" && c.graph != "mermaid" {
+		return nil, fmt.Errorf("invalid graph format '%s'", c.graph)
+	}
+	topo, err := topology.ReadFile(c.topology)
+	if err != nil {
+		return nil, err
+	}
+	msh := mesh.New(ctx)
+	if err := topo.Build(msh, nil); err != nil {
+		return nil, err
+	}
+	if c.input != "" {
+		if _, err := msh.CellInfo(c.input); err != nil {
+			return nil, c.abort(msh, fmt.Errorf("invalid input: %v", err))
+		}
+	}
+	recorder := recording.NewRecorder(msh, stdout)
+	if err := recorder.Record(splitNames(c.print)...); err != nil {
+		return nil, c.abort(msh, err)
+	}
+	return msh, nil
+}
+
+// abort shuts the built mesh down after a failed start and returns
+// the error of the start.
+func (c *meshCommand) abort(msh mesh.Mesh, err error) error {
+	sctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if serr := msh.Shutdown(sctx); serr != nil {
+		return fmt.Errorf("%v (shutdown: %v)", err, serr)
+	}
+	return err
+}
+
+// stop waits if wanted, writes the graph, and shuts the mesh down.
+func (c *meshCommand) stop(ctx context.Context, msh mesh.Mesh, stderr io.Writer) error {
+	if c.wait > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.wait):
+		}
+	}
+	switch c.graph {
+	case "dot":
+		fmt.Fprint(stderr, topology.FromMesh(msh, true).DOT())
+	case "mermaid":
+		fmt.Fprint(stderr, topology.FromMesh(msh, true).Mermaid())
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return msh.Shutdown(sctx)
+}
+
+// open returns the reader for the file name, "-" means stdin.
+func open(filename string, stdin io.Reader) (io.ReadCloser, error) {
+	if filename == "" || filename == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(filename)
+}
+
+//--------------------
+// RUN COMMAND
+//--------------------
+
+// runCommand starts a mesh and feeds events into a cell.
+type runCommand struct {
+	meshCommand
+	events string
+}
+
+// flags implements command.
+func (c *runCommand) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	c.addFlags(fs)
+	fs.StringVar(&c.events, "events", "-", "JSONL file with the events to feed, '-' is stdin")
+	return fs
+}
+
+// execute implements command.
+func (c *runCommand) execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	msh, err := c.start(ctx, stdout)
+	if err != nil {
+		return err
+	}
+	if c.input == "" {
+		<-ctx.Done()
+		return c.stop(ctx, msh, stderr)
+	}
+	r, err := open(c.events, stdin)
+	if err != nil {
+		c.stop(ctx, msh, stderr)
+		return err
+	}
+	defer r.Close()
+	if err := feed(ctx, msh, c.input, r); err != nil {
+		c.stop(ctx, msh, stderr)
+		return err
+	}
+	return c.stop(ctx, msh, stderr)
+}
+
+// inputEvent is the JSON format of an event to feed.
+type inputEvent struct {
+	Topic         string            `json:"topic"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+}
+
+// feed reads the events line by line and emits them to the named cell.
+func feed(ctx context.Context, msh mesh.Mesh, name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !strings.HasPrefix(line, "{") {
+			if err := msh.Emit(name, line); err != nil {
+				return fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			continue
+		}
+		var in inputEvent
+		if err := json.Unmarshal([]byte(line), &in); err != nil {
+			return fmt.Errorf("line %d: invalid event: %v", lineNo, err)
+		}
+		args := []interface{}{
+			mesh.WithHeaders(in.Headers),
+			mesh.WithCorrelationID(in.CorrelationID),
+		}
+		if in.Payload != nil {
+			args = append(args, in.Payload)
+		}
+		if err := msh.Emit(name, in.Topic, args...); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+//--------------------
+// REPLAY COMMAND
+//--------------------
+
+// replayCommand starts a mesh and replays a recorded event log.
+type replayCommand struct {
+	meshCommand
+	log   string
+	speed float64
+}
+
+// flags implements command.
+func (c *replayCommand) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	c.addFlags(fs)
+	fs.StringVar(&c.log, "log", "-", "JSONL file with the recorded events, '-' is stdin")
+	fs.Float64Var(&c.speed, "speed", 1, "speed factor of the replay, 0 replays as fast as possible")
+	return fs
+}
+
+// execute implements command.
+func (c *replayCommand) execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if c.speed < 0 {
+		return fmt.Errorf("invalid speed %v", c.speed)
+	}
+	msh, err := c.start(ctx, stdout)
+	if err != nil {
+		return err
+	}
+	r, err := open(c.log, stdin)
+	if err != nil {
+		c.stop(ctx, msh, stderr)
+		return err
+	}
+	defer r.Close()
+	err = recording.Replay(ctx, msh, r, recording.WithSpeed(c.speed), recording.WithTarget(c.input))
+	if err != nil && err != ctx.Err() {
+		c.stop(ctx, msh, stderr)
+		return err
+	}
+	return c.stop(ctx, msh, stderr)
+}
+
+//--------------------
+// DUMP COMMAND
+//--------------------
+
+// dumpCommand writes a topology in different formats.
+type dumpCommand struct {
+	topology string
+	format   string
+}
+
+// flags implements command.
+func (c *dumpCommand) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.StringVar(&c.topology, "topology", "", "topology file in JSON or YAML (required)")
+	fs.StringVar(&c.format, "format", "yaml", "output format 'yaml', 'json', 'dot', or 'mermaid'")
+	return fs
+}
+
+// execute implements command.
+func (c *dumpCommand) execute(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if c.topology == "" {
+		return errors.New("flag -topology is required")
+	}
+	topo, err := topology.ReadFile(c.topology)
+	if err != nil {
+		return err
+	}
+	if err := topo.Validate(nil); err != nil {
+		return err
+	}
+	switch c.format {
+	case "yaml":
+		enc := yaml.NewEncoder(stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(topo); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(topo)
+	case "dot":
+		_, err = fmt.Fprint(stdout, topo.Graph().DOT())
+		return err
+	case "mermaid":
+		_, err = fmt.Fprint(stdout, topo.Graph().Mermaid())
+		return err
+	}
+	return fmt.Errorf("invalid format '%s'", c.format)
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// splitNames splits a comma separated list of names.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EOF
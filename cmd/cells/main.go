@@ -0,0 +1,129 @@
+// Tideland Go Cells - Commands - Cells
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Command cells runs and inspects meshes described by topology files
+// in JSON or YAML. All behaviors of this module are available.
+//
+//	cells run -topology mesh.yaml -input sensors -print alarms,counter < events.jsonl
+//	cells replay -topology mesh.yaml -log recorded.jsonl -speed 10
+//	cells dump -topology mesh.yaml -format mermaid
+//
+// The command run feeds the lines of stdin or of the file set with
+// -events into the input cell. Each line is either a JSON object with
+// topic, payload, headers, and correlationId, or a plain topic. The
+// events emitted by the cells listed with -print are written to stdout
+// as JSON lines containing the cell name and the event. After the
+// input is read the command waits the duration set with -wait, then
+// it shuts the mesh down, so that all queued events are processed.
+// Without an input cell it runs until it is interrupted.
+//
+// The command replay reads a log as written by the package recording,
+// so also the output of run, and emits the events to the subscribers
+// of the cells they have been recorded for. Lines may also contain
+// only events in their JSON encoding. With -input all events are
+// emitted into the input cell. It keeps the time between the events
+// divided by -speed, a speed of 0 emits them as fast as possible.
+//
+// The command dump writes the topology as YAML, JSON, Graphviz DOT,
+// or Mermaid. The commands run and replay can write the graph of the
+// running mesh including the numbers of delivered events to stderr
+// before shutting it down with -graph dot or -graph mermaid.
+package main // import "tideland.dev/go/cells/cmd/cells"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	_ "tideland.dev/go/cells/behaviors/aggregator"
+	_ "tideland.dev/go/cells/behaviors/broadcaster"
+	_ "tideland.dev/go/cells/behaviors/callback"
+	_ "tideland.dev/go/cells/behaviors/collector"
+	_ "tideland.dev/go/cells/behaviors/combo"
+	_ "tideland.dev/go/cells/behaviors/condition"
+	_ "tideland.dev/go/cells/behaviors/countdown"
+	_ "tideland.dev/go/cells/behaviors/counter"
+	_ "tideland.dev/go/cells/behaviors/evaluator"
+	_ "tideland.dev/go/cells/behaviors/filter"
+	_ "tideland.dev/go/cells/behaviors/mapper"
+	_ "tideland.dev/go/cells/behaviors/onetimer"
+	_ "tideland.dev/go/cells/behaviors/pairer"
+	_ "tideland.dev/go/cells/behaviors/rateevaluator"
+	_ "tideland.dev/go/cells/behaviors/ratewindow"
+	_ "tideland.dev/go/cells/behaviors/router"
+)
+
+//--------------------
+// MAIN
+//--------------------
+
+// usage describes the commands.
+const usage = `usage: cells <command> [flags]
+
+commands:
+  run     start a mesh, feed events into a cell, and print emitted events
+  replay  start a mesh and replay a recorded event log
+  dump    write a topology as yaml, json, dot, or mermaid
+
+Run 'cells <command> -h' for the flags of a command.
+`
+
+// errUsage signals that the usage has been printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "cells: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run dispatches the arguments to the commands.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+	var cmd command
+	switch args[0] {
+	case "run":
+		cmd = &runCommand{}
+	case "replay":
+		cmd = &replayCommand{}
+	case "dump":
+		cmd = &dumpCommand{}
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprintf(stderr, "unknown command '%s'\n\n%s", args[0], usage)
+		return errUsage
+	}
+	fs := cmd.flags()
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments %v\n", fs.Args())
+		return errUsage
+	}
+	return cmd.execute(ctx, stdin, stdout, stderr)
+}
+
+// EOF
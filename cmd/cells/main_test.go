@@ -0,0 +1,201 @@
+// Tideland Go Cells - Commands - Cells - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package main // import "tideland.dev/go/cells/cmd/cells"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/recording"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const testTopology = `
+cells:
+  - name: input
+    kind: broadcaster
+  - name: alarms
+    kind: filter
+    params:
+      topics: ["alarm.*"]
+subscriptions:
+  - emitter: input
+    receptor: alarms
+`
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestUsage verifies the handling of invalid arguments.
+func TestUsage(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx := context.Background()
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(run(ctx, nil, nil, &stdout, &stderr), errUsage)
+	assert.Contains("usage: cells", stderr.String())
+	stderr.Reset()
+	assert.Equal(run(ctx, []string{"dont-exist"}, nil, &stdout, &stderr), errUsage)
+	assert.Contains("unknown command 'dont-exist'", stderr.String())
+	assert.Equal(run(ctx, []string{"dump", "-dont-exist"}, nil, &stdout, &stderr), errUsage)
+	assert.Equal(run(ctx, []string{"dump", "extra"}, nil, &stdout, &stderr), errUsage)
+	assert.ErrorContains(run(ctx, []string{"dump"}, nil, &stdout, &stderr), "flag -topology is required")
+	assert.ErrorContains(run(ctx, []string{"replay", "-topology", "x", "-speed", "-1"}, nil, &stdout, &stderr), "invalid speed -1")
+	assert.NoError(run(ctx, []string{"help"}, nil, &stdout, &stderr))
+	assert.Contains("commands:", stdout.String())
+}
+
+// TestDump verifies the dumping of topologies.
+func TestDump(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx := context.Background()
+	filename := writeTopology(assert, t.TempDir())
+	tests := map[string]string{
+		"yaml":    "receptor: alarms",
+		"json":    `"receptor": "alarms"`,
+		"dot":     `"input" -> "alarms";`,
+		"mermaid": "n0 --> n1",
+	}
+	for format, expected := range tests {
+		var stdout, stderr bytes.Buffer
+		err := run(ctx, []string{"dump", "-topology", filename, "-format", format}, nil, &stdout, &stderr)
+		assert.NoError(err)
+		assert.Contains(expected, stdout.String())
+	}
+	var stdout, stderr bytes.Buffer
+	err := run(ctx, []string{"dump", "-topology", filename, "-format", "dont-exist"}, nil, &stdout, &stderr)
+	assert.ErrorContains(err, "invalid format 'dont-exist'")
+}
+
+// TestRun verifies feeding events into a mesh and printing the
+// emitted ones.
+func TestRun(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filename := writeTopology(assert, t.TempDir())
+	stdin := strings.NewReader(`alarm.fire
+info
+
+{"topic":"alarm.water","payload":{"level":3},"headers":{"tenant":"a"}}
+`)
+	var stdout, stderr bytes.Buffer
+	err := run(ctx, []string{
+		"run", "-topology", filename, "-input", "input", "-print", "input, alarms", "-graph", "dot", "-wait", "100ms",
+	}, stdin, &stdout, &stderr)
+	assert.NoError(err)
+
+	printed := readPrinted(assert, &stdout)
+	assert.Equal(printed["input"], []string{"alarm.fire", "info", "alarm.water", mesh.TopicTerminated})
+	assert.Equal(printed["alarms"], []string{"alarm.fire", "alarm.water", mesh.TopicTerminated})
+	assert.Contains(`"input" -> "alarms" [label="3 events"];`, stderr.String())
+
+	stdin = strings.NewReader("{broken\n")
+	err = run(ctx, []string{"run", "-topology", filename, "-input", "input"}, stdin, &stdout, &stderr)
+	assert.ErrorContains(err, "line 1: invalid event")
+	err = run(ctx, []string{"run", "-topology", filename, "-input", "dont-exist"}, stdin, &stdout, &stderr)
+	assert.ErrorContains(err, "invalid input: cell 'dont-exist' does not exist")
+}
+
+// TestReplay verifies the replaying of recorded events.
+func TestReplay(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	filename := writeTopology(assert, dir)
+	var log bytes.Buffer
+	for _, topic := range []string{"alarm.a", "alarm.b", "alarm.c"} {
+		evt, err := mesh.NewEvent(topic, topic)
+		assert.NoError(err)
+		data, err := json.Marshal(evt)
+		assert.NoError(err)
+		log.Write(data)
+		log.WriteString("\n")
+		time.Sleep(50 * time.Millisecond)
+	}
+	logname := filepath.Join(dir, "recorded.jsonl")
+	assert.NoError(os.WriteFile(logname, log.Bytes(), 0644))
+
+	// Accelerated replay keeps the distances.
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	err := run(ctx, []string{
+		"replay", "-topology", filename, "-input", "input", "-print", "alarms", "-log", logname, "-speed", "2",
+	}, nil, &stdout, &stderr)
+	assert.NoError(err)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+	printed := readPrinted(assert, &stdout)
+	assert.Equal(printed["alarms"], []string{"alarm.a", "alarm.b", "alarm.c", mesh.TopicTerminated})
+
+	// Replay as fast as possible from stdin.
+	stdout.Reset()
+	start = time.Now()
+	err = run(ctx, []string{
+		"replay", "-topology", filename, "-input", "input", "-print", "alarms", "-speed", "0",
+	}, bytes.NewReader(log.Bytes()), &stdout, &stderr)
+	assert.NoError(err)
+	assert.True(time.Since(start) < 50*time.Millisecond)
+	printed = readPrinted(assert, &stdout)
+	assert.Equal(printed["alarms"], []string{"alarm.a", "alarm.b", "alarm.c", mesh.TopicTerminated})
+
+	// Printed events are replayed into the recorded cells.
+	recorded := bytes.NewReader(stdout.Bytes())
+	stdout.Reset()
+	err = run(ctx, []string{
+		"replay", "-topology", filename, "-print", "alarms", "-speed", "0",
+	}, recorded, &stdout, &stderr)
+	assert.NoError(err)
+	printed = readPrinted(assert, &stdout)
+	assert.Equal(printed["alarms"], []string{"alarm.a", "alarm.b", "alarm.c", mesh.TopicTerminated})
+	err = run(ctx, []string{
+		"replay", "-topology", filename, "-speed", "0",
+	}, bytes.NewReader(log.Bytes()), &stdout, &stderr)
+	assert.ErrorContains(err, "line 1: record has no cell and no target is set")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// writeTopology writes the test topology into the directory.
+func writeTopology(assert *asserts.Asserts, dir string) string {
+	filename := filepath.Join(dir, "mesh.yaml")
+	assert.NoError(os.WriteFile(filename, []byte(testTopology), 0644))
+	return filename
+}
+
+// readPrinted returns the topics of the printed events per cell.
+func readPrinted(assert *asserts.Asserts, r *bytes.Buffer) map[string][]string {
+	printed := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(r.String()), "\n") {
+		var rec recording.Record
+		assert.NoError(json.Unmarshal([]byte(line), &rec))
+		printed[rec.Cell] = append(printed[rec.Cell], rec.Event.Topic())
+	}
+	return printed
+}
+
+// EOF
@@ -22,25 +22,78 @@ import (
 // Mesh describes the interface to a mesh of a cell from the
 // perspective of a behavior.
 type Mesh interface {
-	// Go starts a cell using the given behavior.
-	Go(name string, b Behavior) error
+	// Go starts a cell using the given behavior. Options like
+	// the restart policy configure the cell.
+	Go(name string, b Behavior, options ...CellOption) error
 
 	// Subscribe subscribes the cell with receptor name to the cell
 	// with emitter name.
 	Subscribe(emitterName, receptorName string) error
 
+	// SubscribeTopics subscribes the cell with receptor name to the
+	// cell with emitter name for events with topics matching at least
+	// one of the patterns. See MatchTopic() for the pattern syntax.
+	SubscribeTopics(emitterName, receptorName string, patterns ...string) error
+
 	// Unsubscribe unsubscribes the cell with receptor name from the cell
 	// with emitter name.
 	Unsubscribe(emitterName, receptorName string) error
 
+	// Stop stops the named cell. It waits until the events in
+	// its queue are processed and the behavior returned. In case
+	// of an error returned by the behavior it is returned.
+	Stop(name string) error
+
+	// Shutdown stops all cells in the order of their subscriptions,
+	// so that emitters are stopped before their subscribers. Errors
+	// of the behaviors are collected in a ShutdownError. The context
+	// limits the time for draining and stopping. With a snapshot store
+	// the states of the behaviors are saved afterwards.
+	Shutdown(ctx context.Context) error
+
 	// Emit creates an event and raises it to the named cell.
 	Emit(name, topic string, payloads ...interface{}) error
 
 	// EmitEvent raises an event to the named cell.
 	EmitEvent(name string, evt *Event) error
 
+	// Request creates an event and raises it to the named cell. Then
+	// it waits until the behavior replies via Event.Reply() or the
+	// context ends.
+	Request(ctx context.Context, name, topic string, payloads ...interface{}) (*Event, error)
+
 	// Emitter returns a static emitter for the named cell.
 	Emitter(name string) (Emitter, error)
+
+	// Cells returns the sorted names of all cells of the mesh.
+	Cells() []string
+
+	// CellInfo returns information about the named cell.
+	CellInfo(name string) (CellInfo, error)
+
+	// Subscribers returns the sorted names of the cells subscribed
+	// to the named cell.
+	Subscribers(name string) ([]string, error)
+
+	// Subscriptions returns the sorted names of the cells the named
+	// cell is subscribed to.
+	Subscriptions(name string) ([]string, error)
+
+	// SubscriptionTopics returns the topic patterns of the subscription
+	// of the receptor cell to the emitter cell. No patterns mean that
+	// all events are received.
+	SubscriptionTopics(emitterName, receptorName string) ([]string, error)
+
+	// Metrics returns the metrics of all cells sorted by name.
+	Metrics() []CellMetrics
+
+	// Snapshot saves the states of all cells whose behaviors implement
+	// Snapshotter in the store set with WithSnapshots().
+	Snapshot() error
+
+	// Restore restores the states of all cells whose behaviors
+	// implement Snapshotter out of the store set with WithSnapshots().
+	Restore() error
 }
 
 //--------------------
@@ -57,8 +110,20 @@ type Cell interface {
 	// behavior.
 	Name() string
 
-	// Mesh returns the mesh of the cell.
+	// Mesh returns the mesh of the cell. Cells started through
+	// it are children of the cell and stopped together with it.
+	// Events emitted through it keep their emitters path extended
+	// by the cell.
 	Mesh() Mesh
+
+	// Clock returns the clock of the mesh. Behaviors use it
+	// instead of the time package, so that they can be tested
+	// with a ManualClock.
+	Clock() Clock
+
+	// Logger returns the logger of the mesh tagged with the
+	// name of the cell and the type of its behavior.
+	Logger() Logger
 }
 
 //--------------------
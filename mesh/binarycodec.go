@@ -0,0 +1,404 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+//--------------------
+// BINARY CODEC
+//--------------------
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// binaryCodec implements a compact binary Codec.
+type binaryCodec struct{}
+
+// NewBinaryCodec returns a compact binary codec. It writes no type
+// information or field names, only the values. Integers are encoded
+// as varints, floats with their fixed size, strings and byte slices
+// with their length. Structs are encoded field by field in the order
+// of their exported fields, types implementing encoding.BinaryMarshaler
+// like time.Time using that. So the types of sender and receiver have
+// to match. Interface values can be marshalled but not unmarshalled,
+// so multiple payloads have to be read into a typed slice.
+func NewBinaryCodec() Codec {
+	return binaryCodec{}
+}
+
+// Name implements Codec.
+func (c binaryCodec) Name() string {
+	return CodecBinary
+}
+
+// Marshal implements Codec.
+func (c binaryCodec) Marshal(payload interface{}) ([]byte, error) {
+	v := reflect.ValueOf(payload)
+	if !v.IsValid() {
+		return nil, errors.New("cannot marshal nil")
+	}
+	return c.encode(nil, v)
+}
+
+// Unmarshal implements Codec.
+func (c binaryCodec) Unmarshal(data []byte, payload interface{}) error {
+	v := reflect.ValueOf(payload)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot unmarshal into %T", payload)
+	}
+	rest, err := c.decode(data, v.Elem())
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d bytes left after unmarshalling", len(rest))
+	}
+	return nil
+}
+
+// encode appends the encoded value to the buffer.
+func (c binaryCodec) encode(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Type().Implements(binaryMarshalerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = appendUvarint(buf, uint64(len(data)))
+		return append(buf, data...), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUvarint(buf, v.Uint()), nil
+	case reflect.Float32:
+		return appendUint64(buf, uint64(math.Float32bits(float32(v.Float()))), 4), nil
+	case reflect.Float64:
+		return appendUint64(buf, math.Float64bits(v.Float()), 8), nil
+	case reflect.String:
+		buf = appendUvarint(buf, uint64(v.Len()))
+		return append(buf, v.String()...), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = appendUvarint(buf, uint64(v.Len())+1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buf, v.Bytes()...), nil
+		}
+		return c.encodeElems(buf, v)
+	case reflect.Array:
+		return c.encodeElems(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = appendUvarint(buf, uint64(v.Len())+1)
+		var err error
+		iter := v.MapRange()
+		for iter.Next() {
+			if buf, err = c.encode(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = c.encode(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Struct:
+		var err error
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if buf, err = c.encode(buf, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return c.encode(append(buf, 1), v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, errors.New("cannot marshal nil interface")
+		}
+		return c.encode(buf, v.Elem())
+	}
+	return nil, fmt.Errorf("cannot marshal type %v", v.Type())
+}
+
+// encodeElems appends the encoded elements of a slice or array.
+func (c binaryCodec) encodeElems(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = c.encode(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// decode sets the value based on the data and returns the rest.
+func (c binaryCodec) decode(data []byte, v reflect.Value) ([]byte, error) {
+	if v.Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(binaryUnmarshalerType) {
+		n, rest, err := c.decodeLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(rest)) < n {
+			return nil, errors.New("unexpected end of data")
+		}
+		um := v.Addr().Interface().(encoding.BinaryUnmarshaler)
+		if err := um.UnmarshalBinary(rest[:n]); err != nil {
+			return nil, err
+		}
+		return rest[n:], nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if len(data) < 1 {
+			return nil, errors.New("unexpected end of data")
+		}
+		v.SetBool(data[0] != 0)
+		return data[1:], nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid varint")
+		}
+		if v.OverflowInt(i) {
+			return nil, fmt.Errorf("value %d overflows %v", i, v.Type())
+		}
+		v.SetInt(i)
+		return data[n:], nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid uvarint")
+		}
+		if v.OverflowUint(u) {
+			return nil, fmt.Errorf("value %d overflows %v", u, v.Type())
+		}
+		v.SetUint(u)
+		return data[n:], nil
+	case reflect.Float32:
+		if len(data) < 4 {
+			return nil, errors.New("unexpected end of data")
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))))
+		return data[4:], nil
+	case reflect.Float64:
+		if len(data) < 8 {
+			return nil, errors.New("unexpected end of data")
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)))
+		return data[8:], nil
+	case reflect.String:
+		n, rest, err := c.decodeLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(rest)) < n {
+			return nil, errors.New("unexpected end of data")
+		}
+		v.SetString(string(rest[:n]))
+		return rest[n:], nil
+	case reflect.Slice:
+		n, rest, err := c.decodeLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return rest, nil
+		}
+		n--
+		if !fitsLen(n, minEncodedSize(v.Type().Elem()), rest) {
+			return nil, errors.New("unexpected end of data")
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bs := reflect.MakeSlice(v.Type(), int(n), int(n))
+			reflect.Copy(bs, reflect.ValueOf(rest[:n]))
+			v.Set(bs)
+			return rest[n:], nil
+		}
+		v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		return c.decodeElems(rest, v)
+	case reflect.Array:
+		return c.decodeElems(data, v)
+	case reflect.Map:
+		n, rest, err := c.decodeLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return rest, nil
+		}
+		n--
+		size := minEncodedSize(v.Type().Key()) + minEncodedSize(v.Type().Elem())
+		if !fitsLen(n, size, rest) {
+			return nil, errors.New("unexpected end of data")
+		}
+		m := reflect.MakeMap(v.Type())
+		for i := uint64(0); i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if rest, err = c.decode(rest, key); err != nil {
+				return nil, err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if rest, err = c.decode(rest, value); err != nil {
+				return nil, err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return rest, nil
+	case reflect.Struct:
+		var err error
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if data, err = c.decode(data, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case reflect.Ptr:
+		if len(data) < 1 {
+			return nil, errors.New("unexpected end of data")
+		}
+		if data[0] == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return data[1:], nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		rest, err := c.decode(data[1:], elem.Elem())
+		if err != nil {
+			return nil, err
+		}
+		v.Set(elem)
+		return rest, nil
+	}
+	return nil, fmt.Errorf("cannot unmarshal type %v", v.Type())
+}
+
+// decodeElems decodes the elements of a slice or array.
+func (c binaryCodec) decodeElems(data []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if data, err = c.decode(data, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// decodeLen reads a length and returns it together with the rest.
+func (c binaryCodec) decodeLen(data []byte) (uint64, []byte, error) {
+	n, l := binary.Uvarint(data)
+	if l <= 0 {
+		return 0, nil, errors.New("invalid length")
+	}
+	if n > math.MaxInt {
+		return 0, nil, fmt.Errorf("length %d too large", n)
+	}
+	return n, data[l:], nil
+}
+
+// minEncodedSize returns the minimum number of bytes a value of the
+// type needs when encoded. Zero-size types like empty structs need
+// none.
+func minEncodedSize(t reflect.Type) uint64 {
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(binaryUnmarshalerType) {
+		return 1
+	}
+	switch t.Kind() {
+	case reflect.Float32:
+		return 4
+	case reflect.Float64:
+		return 8
+	case reflect.Array:
+		elem := minEncodedSize(t.Elem())
+		if elem == 0 || t.Len() == 0 {
+			return 0
+		}
+		if uint64(t.Len()) > math.MaxUint32/elem {
+			return math.MaxUint32
+		}
+		return uint64(t.Len()) * elem
+	case reflect.Struct:
+		var size uint64
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			size += minEncodedSize(t.Field(i).Type)
+			if size > math.MaxUint32 {
+				return math.MaxUint32
+			}
+		}
+		return size
+	}
+	return 1
+}
+
+// fitsLen checks if n elements with the minimum encoded size fit into
+// the data. A size of 0 sets no limit.
+func fitsLen(n, size uint64, data []byte) bool {
+	if size == 0 {
+		return true
+	}
+	return n <= uint64(len(data))/size
+}
+
+// appendUvarint appends an unsigned varint to the buffer.
+func appendUvarint(buf []byte, u uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], u)
+	return append(buf, tmp[:n]...)
+}
+
+// appendVarint appends a signed varint to the buffer.
+func appendVarint(buf []byte, i int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], i)
+	return append(buf, tmp[:n]...)
+}
+
+// appendUint64 appends size bytes of the value in little endian
+// order to the buffer.
+func appendUint64(buf []byte, u uint64, size int) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], u)
+	return append(buf, tmp[:size]...)
+}
+
+// EOF
@@ -14,47 +14,178 @@ package mesh // import "tideland.dev/go/cells/mesh"
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+//--------------------
+// ERRORS
+//--------------------
+
+// errCellDeactivated is returned when events are passed to a
+// deactivated cell.
+var errCellDeactivated = errors.New("cell deactivated")
+
+// defaultStopTimeout is the time stopping a cell waits by default.
+const defaultStopTimeout = 10 * time.Second
+
 //--------------------
 // CELL SET
 //--------------------
 
-// cellSet manages a set of cells.
+// cellLink contains the topic patterns of a cell in a set and
+// the number of events delivered to it. In the set of subscribers
+// it also contains the lane to the cell.
+type cellLink struct {
+	patterns  []string
+	delivered uint64
+	lane      *lane
+}
+
+// cellSet manages a set of cells. Each cell can have topic
+// patterns, e.g. to filter the events for subscribers. The
+// cells are kept in the order of their names.
 type cellSet struct {
 	mu    sync.RWMutex
-	cells map[*cell]struct{}
+	from  *cell
+	cells map[*cell]*cellLink
+	order []*cell
 }
 
 // newCellSet creates an empty cell set.
 func newCellSet() *cellSet {
 	return &cellSet{
-		cells: make(map[*cell]struct{}),
+		cells: make(map[*cell]*cellLink),
 	}
 }
 
+// newSubscriberSet creates an empty set for the subscribers of
+// the cell. Each subscriber gets an own lane.
+func newSubscriberSet(from *cell) *cellSet {
+	cs := newCellSet()
+	cs.from = from
+	return cs
+}
+
 // add adds another cell to the set. Already added
-// ones are ignored.
-func (cs *cellSet) add(c *cell) {
+// ones get the new topic patterns.
+func (cs *cellSet) add(c *cell, patterns ...string) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	cs.cells[c] = struct{}{}
+	if link, ok := cs.cells[c]; ok {
+		link.patterns = patterns
+		return
+	}
+	link := &cellLink{
+		patterns: patterns,
+	}
+	if cs.from != nil {
+		link.lane = newLane(cs.from, c, link)
+	}
+	cs.cells[c] = link
+	i := sort.Search(len(cs.order), func(i int) bool {
+		return cs.order[i].name >= c.name
+	})
+	cs.order = append(cs.order, nil)
+	copy(cs.order[i+1:], cs.order[i:])
+	cs.order[i] = c
+}
+
+// patterns returns the topic patterns of a cell and if
+// it is part of the set.
+func (cs *cellSet) patterns(c *cell) ([]string, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	link, ok := cs.cells[c]
+	if !ok {
+		return nil, false
+	}
+	return append([]string(nil), link.patterns...), true
+}
+
+// delivered returns the number of events delivered to
+// each cell of the set by name.
+func (cs *cellSet) delivered() map[string]uint64 {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	delivered := make(map[string]uint64, len(cs.cells))
+	for c, link := range cs.cells {
+		delivered[c.name] = atomic.LoadUint64(&link.delivered)
+	}
+	return delivered
 }
 
-// remove deletes a cell from the set.
+// remove deletes a cell from the set. Its lane is closed after
+// delivering the already pushed events.
 func (cs *cellSet) remove(c *cell) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	link, ok := cs.cells[c]
+	if !ok {
+		return
+	}
+	if link.lane != nil {
+		link.lane.close()
+	}
 	delete(cs.cells, c)
+	for i, oc := range cs.order {
+		if oc == c {
+			cs.order = append(cs.order[:i], cs.order[i+1:]...)
+			break
+		}
+	}
 }
 
-// do perform f for each cell of the set.
+// names returns the sorted names of the cells of the set.
+func (cs *cellSet) names() []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	names := make([]string, len(cs.order))
+	for i, c := range cs.order {
+		names[i] = c.name
+	}
+	return names
+}
+
+// list returns the cells of the set sorted by name.
+func (cs *cellSet) list() []*cell {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return append([]*cell(nil), cs.order...)
+}
+
+// push appends the event to the lanes of the subscribers whose
+// topic patterns match its topic, in the order of their names.
+// The lanes are collected first, so waiting for a full lane does
+// not lock the set. Errors do not stop it, the first one is returned.
+func (cs *cellSet) push(evt *Event) error {
+	cs.mu.RLock()
+	var lanes []*lane
+	for _, c := range cs.order {
+		link := cs.cells[c]
+		if MatchTopics(link.patterns, evt.Topic()) {
+			lanes = append(lanes, link.lane)
+		}
+	}
+	cs.mu.RUnlock()
+	var first error
+	for _, l := range lanes {
+		if err := l.push(evt); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// do perform f for each cell of the set in the order of
+// their names.
 func (cs *cellSet) do(f func(c *cell) error) error {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
-	for c := range cs.cells {
+	for _, c := range cs.order {
 		if err := f(c); err != nil {
 			return err
 		}
@@ -68,29 +199,72 @@ func (cs *cellSet) do(f func(c *cell) error) error {
 
 // cell runs a behevior networked with other cells.
 type cell struct {
-	mu       sync.RWMutex
-	active   atomic.Value
-	ctx      context.Context
-	name     string
-	mesh     Mesh
-	behavior Behavior
-	in       *stream
-	input    *cellSet
-	output   *cellSet
-	drop     func()
+	emitted      uint64
+	errors       uint64
+	restarts     uint64
+	undelivered  uint64
+	incoming     int64
+	mu           sync.RWMutex
+	active       atomic.Value
+	ctx          context.Context
+	cancel       func()
+	done         chan struct{}
+	err          error
+	stopTimeout  time.Duration
+	stopCtx      context.Context
+	startedAt    time.Time
+	name         string
+	mesh         Mesh
+	behavior     Behavior
+	codec        Codec
+	clock        Clock
+	supervisor   *supervisor
+	in           *stream
+	input        *cellSet
+	output       *cellSet
+	parent       *cell
+	children     *cellSet
+	interceptors interceptorChain
+	tracer       Tracer
+	logger       Logger
+	deadLetters  func(dl DeadLetter)
+	drop         func()
 }
 
 // newCell starts a new cell working in the background.
-func newCell(ctx context.Context, name string, m Mesh, b Behavior, drop func()) *cell {
+func newCell(ctx context.Context, name string, m Mesh, b Behavior, drop func(), options ...CellOption) *cell {
+	cfg := newCellConfig(options...)
+	ctx, cancel := context.WithCancel(ctx)
 	c := &cell{
-		ctx:      ctx,
-		name:     name,
-		mesh:     m,
-		behavior: b,
-		in:       newStream(),
-		input:    newCellSet(),
-		output:   newCellSet(),
-		drop:     drop,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		stopTimeout:  cfg.stopTimeout,
+		startedAt:    cfg.clock.Now(),
+		name:         name,
+		mesh:         m,
+		behavior:     b,
+		codec:        cfg.codec,
+		clock:        cfg.clock,
+		supervisor:   newSupervisor(cfg.restart),
+		in:           newStream(name, cfg.queue),
+		input:        newCellSet(),
+		parent:       cfg.parent,
+		children:     newCellSet(),
+		interceptors: cfg.interceptors,
+		tracer:       cfg.tracer,
+		logger:       withTags(cfg.logger, "cell", name, "behavior", fmt.Sprintf("%T", b)),
+		deadLetters:  cfg.deadLetters,
+		drop:         drop,
+	}
+	c.output = newSubscriberSet(c)
+	c.in.tracer = c.tracer
+	c.in.logger = c.logger
+	if c.parent != nil {
+		c.parent.children.add(c)
+		c.logger.Info("cell started", "parent", c.parent.name)
+	} else {
+		c.logger.Info("cell started")
 	}
 	c.active.Store(true)
 	go c.backend()
@@ -107,18 +281,56 @@ func (c *cell) Name() string {
 	return c.name
 }
 
-// Mesh implements Cell.
+// Mesh implements Cell. Cells started via the returned mesh
+// become children of this cell.
 func (c *cell) Mesh() Mesh {
-	return nil
+	if m, ok := c.mesh.(*mesh); ok {
+		return &cellMesh{
+			mesh:   m,
+			parent: c,
+		}
+	}
+	return c.mesh
+}
+
+// Clock implements Cell.
+func (c *cell) Clock() Clock {
+	return c.clock
+}
+
+// Logger implements Cell.
+func (c *cell) Logger() Logger {
+	return c.logger
+}
+
+// info returns information about the cell.
+func (c *cell) info() CellInfo {
+	parentName := ""
+	if c.parent != nil {
+		parentName = c.parent.name
+	}
+	return CellInfo{
+		Name:      c.name,
+		Parent:    parentName,
+		Behavior:  fmt.Sprintf("%T", c.behavior),
+		StartedAt: c.startedAt,
+		QueueLen:  c.in.len(),
+		Processed: c.in.pulled(),
+		Emitted:   atomic.LoadUint64(&c.emitted),
+		Delivered: c.output.delivered(),
+		Active:    c.active.Load().(bool),
+	}
 }
 
 // subscribeTo adds this cell to the out-streams of the
-// given in-cell.
-func (c *cell) subscribeTo(ic *cell) {
+// given in-cell. Only events with topics matching one of
+// the patterns will be received, no patterns means all.
+func (c *cell) subscribeTo(ic *cell, patterns ...string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.input.add(ic)
-	ic.output.add(c)
+	ic.output.add(c, patterns...)
+	c.logger.Info("cell subscribed", "emitter", ic.name, "patterns", patterns)
 }
 
 // unsubscribeFrom removes this cell from the out-streams of the
@@ -128,11 +340,12 @@ func (c *cell) unsubscribeFrom(ic *cell) {
 	defer c.mu.Unlock()
 	c.input.remove(ic)
 	ic.output.remove(c)
+	c.logger.Info("cell unsubscribed", "emitter", ic.name)
 }
 
 // receive creates an passes an event to handle to the cell.
 func (c *cell) receive(topic string, payload ...interface{}) error {
-	evt, err := NewEvent(topic, payload...)
+	evt, err := c.newEvent(topic, payload...)
 	if err != nil {
 		return err
 	}
@@ -142,20 +355,120 @@ func (c *cell) receive(topic string, payload ...interface{}) error {
 // receiveEvent passes an event to handle to the cell.
 func (c *cell) receiveEvent(evt *Event) error {
 	if !c.active.Load().(bool) {
-		return errors.New("cell deactivated")
+		return errCellDeactivated
+	}
+	return c.accept(evt)
+}
+
+// accept passes an event into the queue of the cell. Events rejected
+// by an interceptor are reported to the subscribers.
+func (c *cell) accept(evt *Event) error {
+	evt = c.intercepted(evt)
+	if evt == nil {
+		return nil
 	}
 	return c.in.EmitEvent(evt)
 }
 
-// shutdown deactivates the in-stream, unsubscribes from all cells
-// and tells the mesh that it's not available anymore.
+// acceptQueued passes an event out of a lane into the queue of the
+// cell. Its slot in the queue has already been admitted when pushing
+// it into the lane. Lanes use it directly, so that events emitted
+// before the cell has been deactivated are still processed.
+func (c *cell) acceptQueued(evt *Event) error {
+	evt = c.intercepted(evt)
+	if evt == nil {
+		c.in.release()
+		return nil
+	}
+	return c.in.enqueue(evt)
+}
+
+// intercepted passes the event to the receive interceptors. Rejected
+// events are reported to the subscribers and nil is returned.
+func (c *cell) intercepted(evt *Event) *Event {
+	topic := evt.Topic()
+	evt, err := c.interceptors.intercept(c.name, InterceptReceive, evt)
+	if err != nil {
+		c.rejected(InterceptReceive, topic, err)
+		return nil
+	}
+	return evt
+}
+
+// stop deactivates the cell, waits until the events in its lanes and
+// its queue are processed, and then cancels the context of the
+// behavior. It returns the error of the behavior or in case of the
+// context ending while waiting the according error. The context is
+// also used for stopping the children.
+func (c *cell) stop(ctx context.Context) error {
+	c.active.Store(false)
+	c.mu.Lock()
+	if c.stopCtx == nil {
+		c.stopCtx = ctx
+	}
+	c.mu.Unlock()
+	for c.in.len() > 0 || atomic.LoadInt64(&c.incoming) > 0 {
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			c.cancel()
+			return fmt.Errorf("cell '%s' not drained: %v", c.name, ctx.Err())
+		case <-c.in.pulledc:
+		}
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return fmt.Errorf("cell '%s' not stopped: %v", c.name, ctx.Err())
+	}
+}
+
+// stopWithTimeout stops the cell waiting at most its stop timeout.
+func (c *cell) stopWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.stopTimeout)
+	defer cancel()
+	return c.stop(ctx)
+}
+
+// shutdown deactivates the in-stream, unsubscribes from all cells,
+// tells the mesh that it's not available anymore, and stops the
+// children. If the cell has been stopped the children are stopped
+// with the same context, otherwise with their stop timeouts.
 func (c *cell) shutdown() {
 	c.active.Store(false)
+	c.in.close()
+	c.cancel()
 	c.drop()
+	if c.parent != nil {
+		c.parent.children.remove(c)
+	}
+	c.mu.RLock()
+	ctx := c.stopCtx
+	c.mu.RUnlock()
+	for _, child := range c.children.list() {
+		var err error
+		if ctx != nil {
+			err = child.stop(ctx)
+		} else {
+			err = child.stopWithTimeout()
+		}
+		if err != nil {
+			c.logger.Warn("child not stopped", "child", child.name, "error", err)
+		}
+	}
 	c.input.do(func(ic *cell) error {
 		ic.output.remove(c)
 		return nil
 	})
+	for _, oc := range c.output.list() {
+		oc.input.remove(c)
+		c.output.remove(oc)
+	}
+	c.logger.Info("cell terminated")
+	close(c.done)
 }
 
 // Pull implements Receptor.
@@ -165,39 +478,155 @@ func (c *cell) Pull() <-chan *Event {
 
 // Emit implements Emitter.
 func (c *cell) Emit(topic string, payloads ...interface{}) error {
-	evt, err := NewEvent(topic, payloads...)
+	evt, err := c.newEvent(topic, payloads...)
 	if err != nil {
 		return err
 	}
 	return c.EmitEvent(evt)
 }
 
-// EmitEvent implements Emitter.
+// newEvent creates an event using the codec and the clock of the cell.
+func (c *cell) newEvent(topic string, payloads ...interface{}) (*Event, error) {
+	payloads = append([]interface{}{WithCodec(c.codec), WithTimestamp(c.clock.Now())}, payloads...)
+	return NewEvent(topic, payloads...)
+}
+
+// EmitEvent implements Emitter. Events rejected by an interceptor
+// are reported to the subscribers. With a tracer the emitting is
+// covered by a span.
 func (c *cell) EmitEvent(evt *Event) error {
-	evt.appendEmitter(c.name)
-	return c.output.do(func(oc *cell) error {
-		if err := oc.receiveEvent(evt); err != nil {
-			return err
-		}
+	evt.initCause(c.in.current())
+	evt = evt.withEmitter(c.name)
+	var span Span
+	if c.tracer != nil {
+		evt, span = startSpan(c.tracer, SpanEmit, c.name, evt)
+		defer span.End()
+	}
+	topic := evt.Topic()
+	evt, err := c.interceptors.intercept(c.name, InterceptEmit, evt)
+	if err != nil {
+		failSpan(span, err)
+		c.rejected(InterceptEmit, topic, err)
+		return nil
+	}
+	if evt == nil {
 		return nil
+	}
+	if err := c.deliver(evt); err != nil {
+		failSpan(span, err)
+		return err
+	}
+	return nil
+}
+
+// deliver passes the emitted event to the lanes of the matching
+// subscribers. A failed delivery does not stop the delivery to the
+// other ones. The lanes pass it as dead letter of this cell to the
+// configured handler, the first error is returned.
+func (c *cell) deliver(evt *Event) error {
+	atomic.AddUint64(&c.emitted, 1)
+	return c.output.push(evt)
+}
+
+// deadLetter handles an event which could not be delivered.
+func (c *cell) deadLetter(evt *Event, target string, err error) {
+	atomic.AddUint64(&c.undelivered, 1)
+	c.logger.Warn("event not delivered", "target", target, "topic", evt.Topic(), "error", err)
+	if c.deadLetters == nil {
+		return
+	}
+	c.deadLetters(DeadLetter{
+		Event:     evt,
+		Emitter:   c.name,
+		Target:    target,
+		Reason:    err.Error(),
+		Attempts:  1,
+		Timestamp: c.clock.Now(),
 	})
 }
 
-// backend runs as goroutine and cares for the behavior.
+// rejected notifies the subscribers about an event rejected by an
+// interceptor. The notification itself is not intercepted.
+func (c *cell) rejected(point InterceptionPoint, topic string, err error) {
+	atomic.AddUint64(&c.errors, 1)
+	c.logger.Warn("event rejected", "point", point, "topic", topic, "error", err)
+	evt, nerr := c.newEvent(TopicError, PayloadCellError{
+		CellName: c.name,
+		Error:    fmt.Sprintf("%s of event '%s' rejected: %v", point, topic, err),
+	})
+	if nerr != nil {
+		return
+	}
+	c.deliver(evt.withEmitter(c.name))
+}
+
+// backend runs as goroutine and cares for the behavior. Depending
+// on the restart policy the behavior is restarted after it returned.
+// The cell itself with its subscriptions stays the same.
 func (c *cell) backend() {
 	defer c.shutdown()
-	if err := c.behavior.Go(c, c, c); err != nil {
-		// Notify subscribers about error.
-		c.Emit(TopicError, PayloadCellError{
-			CellName: c.name,
-			Error:    err.Error(),
-		})
-	} else {
-		// Notify subscribers about termination.
-		c.Emit(TopicTerminated, PayloadTermination{
+	for {
+		err := c.behavior.Go(c, c, c)
+		c.err = err
+		errText := ""
+		if err != nil {
+			// Notify subscribers about error.
+			atomic.AddUint64(&c.errors, 1)
+			c.logger.Error("behavior failed", "error", err)
+			c.in.fail(err)
+			errText = err.Error()
+			c.Emit(TopicError, PayloadCellError{
+				CellName: c.name,
+				Error:    errText,
+			})
+		}
+		if c.ctx.Err() != nil {
+			c.terminated(err)
+			return
+		}
+		decision, backoff := c.supervisor.next(err, c.clock.Now())
+		switch decision {
+		case decisionStop:
+			c.terminated(err)
+			return
+		case decisionGiveUp:
+			// Notify subscribers about exceeded restarts.
+			c.logger.Error("cell gave up", "restarts", c.supervisor.total, "error", errText)
+			c.Emit(TopicGivenUp, PayloadGiveUp{
+				CellName: c.name,
+				Restarts: c.supervisor.total,
+				Error:    errText,
+			})
+			return
+		}
+		// Wait before restart.
+		c.logger.Warn("cell restarting", "backoff", backoff, "restarts", c.supervisor.total)
+		timer := c.clock.NewTimer(backoff)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			c.terminated(err)
+			return
+		case <-timer.C():
+		}
+		// Notify subscribers about restart.
+		atomic.AddUint64(&c.restarts, 1)
+		c.Emit(TopicRestarted, PayloadRestart{
 			CellName: c.name,
+			Restarts: c.supervisor.total,
+			Error:    errText,
 		})
 	}
 }
 
+// terminated notifies the subscribers about a normal termination.
+func (c *cell) terminated(err error) {
+	if err != nil {
+		return
+	}
+	c.Emit(TopicTerminated, PayloadTermination{
+		CellName: c.name,
+	})
+}
+
 // EOF
@@ -14,6 +14,7 @@ package mesh // import "tideland.dev/go/cells/mesh"
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -150,14 +151,193 @@ func TestCellAutoUnsubscribe(t *testing.T) {
 	cancel()
 }
 
+// TestCellFanOut verifies the independent and ordered delivery
+// to the subscribers.
+func TestCellFanOut(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	releasec := make(chan struct{})
+	fastc := make(chan string, 10)
+	slowc := make(chan string, 10)
+	forwarder := func(cell Cell, evt *Event, out Emitter) error {
+		return out.EmitEvent(evt)
+	}
+	fast := func(cell Cell, evt *Event, out Emitter) error {
+		fastc <- evt.Topic()
+		return nil
+	}
+	slow := func(cell Cell, evt *Event, out Emitter) error {
+		<-releasec
+		slowc <- evt.Topic()
+		return nil
+	}
+	cEmitter := newCell(ctx, "emitter", meshStub{}, NewRequestBehavior(forwarder), drop)
+	cFast := newCell(ctx, "fast", meshStub{}, NewRequestBehavior(fast), drop)
+	cSlow := newCell(ctx, "slow", meshStub{}, NewRequestBehavior(slow), drop,
+		WithQueue(8, QueueBlock),
+		WithQueueTimeout(0),
+	)
+	cSlow.subscribeTo(cEmitter)
+	cFast.subscribeTo(cEmitter)
+	assert.Equal(cEmitter.output.names(), []string{"fast", "slow"})
+
+	topics := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, topic := range topics {
+		cEmitter.receive(topic)
+	}
+
+	// Fast subscriber gets all events while the slow one blocks.
+	for _, topic := range topics {
+		select {
+		case received := <-fastc:
+			assert.Equal(received, topic)
+		case <-time.After(time.Second):
+			assert.Fail("fast subscriber is blocked")
+		}
+	}
+	close(releasec)
+	for _, topic := range topics {
+		select {
+		case received := <-slowc:
+			assert.Equal(received, topic)
+		case <-time.After(time.Second):
+			assert.Fail("slow subscriber is blocked")
+		}
+	}
+}
+
+// TestCellStuckOverflow verifies that the full queue of a subscriber
+// never pulling returns overflow errors to the emitter and creates
+// dead letters while the other subscribers still get all events.
+func TestCellStuckOverflow(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 100)
+	fastc := make(chan string, 100)
+	deadc := make(chan DeadLetter, 100)
+	forwarder := func(cell Cell, evt *Event, out Emitter) error {
+		if err := out.EmitEvent(evt); err != nil {
+			errc <- err
+		}
+		return nil
+	}
+	fast := func(cell Cell, evt *Event, out Emitter) error {
+		fastc <- evt.Topic()
+		return nil
+	}
+	cEmitter := newCell(ctx, "emitter", meshStub{}, NewRequestBehavior(forwarder), drop,
+		withDeadLetters(func(dl DeadLetter) {
+			deadc <- dl
+		}),
+	)
+	cFast := newCell(ctx, "fast", meshStub{}, NewRequestBehavior(fast), drop)
+	cStuck := newCell(ctx, "stuck", meshStub{}, BehaviorFunc(stuckFunc), drop,
+		WithQueue(1, QueueFailFast),
+	)
+	cFast.subscribeTo(cEmitter)
+	cStuck.subscribeTo(cEmitter)
+
+	count := 5
+	for i := 0; i < count; i++ {
+		assert.NoError(cEmitter.receive(fmt.Sprintf("event-%d", i)))
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case received := <-fastc:
+			assert.Equal(received, fmt.Sprintf("event-%d", i))
+		case <-time.After(time.Second):
+			assert.Fail("fast subscriber is blocked")
+		}
+	}
+
+	// All events after the first one overflow like when emitted
+	// via the mesh.
+	overflows := count - 1
+	assert.Retry(func() bool {
+		return len(errc) == overflows
+	}, 100, 10*time.Millisecond)
+	for i := 0; i < overflows; i++ {
+		var oerr *QueueOverflowError
+		assert.True(errors.As(<-errc, &oerr))
+		assert.Equal(oerr.CellName, "stuck")
+		assert.Equal(oerr.Policy, QueueFailFast)
+		dl := <-deadc
+		assert.Equal(dl.Target, "stuck")
+	}
+}
+
+// TestCellStuckUnsubscribe verifies that unsubscribing a subscriber
+// never pulling releases the emitter waiting for its full queue.
+func TestCellStuckUnsubscribe(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fastc := make(chan string, 100)
+	forwarder := func(cell Cell, evt *Event, out Emitter) error {
+		return out.EmitEvent(evt)
+	}
+	fast := func(cell Cell, evt *Event, out Emitter) error {
+		fastc <- evt.Topic()
+		return nil
+	}
+	cEmitter := newCell(ctx, "emitter", meshStub{}, NewRequestBehavior(forwarder), drop)
+	cFast := newCell(ctx, "fast", meshStub{}, NewRequestBehavior(fast), drop)
+	cStuck := newCell(ctx, "stuck", meshStub{}, BehaviorFunc(stuckFunc), drop,
+		WithQueue(1, QueueBlock),
+		WithQueueTimeout(0),
+	)
+	cFast.subscribeTo(cEmitter)
+	cStuck.subscribeTo(cEmitter)
+
+	count := 5
+	for i := 0; i < count; i++ {
+		assert.NoError(cEmitter.receive(fmt.Sprintf("event-%d", i)))
+	}
+	// Emitter waits for the queue of the stuck subscriber with
+	// the second event.
+	assert.Retry(func() bool {
+		return len(fastc) >= 2
+	}, 100, 10*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(len(fastc), 2)
+
+	unsubscribedc := make(chan struct{})
+	go func() {
+		cStuck.unsubscribeFrom(cEmitter)
+		close(unsubscribedc)
+	}()
+	select {
+	case <-unsubscribedc:
+	case <-time.After(time.Second):
+		assert.Fail("unsubscribe is blocked")
+	}
+	assert.Equal(cEmitter.output.names(), []string{"fast"})
+	for i := 0; i < count; i++ {
+		select {
+		case received := <-fastc:
+			assert.Equal(received, fmt.Sprintf("event-%d", i))
+		case <-time.After(time.Second):
+			assert.Fail("fast subscriber is blocked")
+		}
+	}
+}
+
 //--------------------
 // STUBS
 //--------------------
 
+// stuckFunc never pulls any event.
+func stuckFunc(cell Cell, in Receptor, out Emitter) error {
+	<-cell.Context().Done()
+	return nil
+}
+
 // meshStub simulates the mesh for the cells.
 type meshStub struct{}
 
-func (ms meshStub) Go(name string, b Behavior) error {
+func (ms meshStub) Go(name string, b Behavior, options ...CellOption) error {
 	return nil
 }
 
@@ -165,10 +345,26 @@ func (ms meshStub) Subscribe(fromName, toName string) error {
 	return nil
 }
 
+func (ms meshStub) SubscribeTopics(fromName, toName string, patterns ...string) error {
+	return nil
+}
+
 func (ms meshStub) Unsubscribe(toName, fromName string) error {
 	return nil
 }
 
+func (ms meshStub) SubscriptionTopics(fromName, toName string) ([]string, error) {
+	return nil, nil
+}
+
+func (ms meshStub) Stop(name string) error {
+	return nil
+}
+
+func (ms meshStub) Shutdown(ctx context.Context) error {
+	return nil
+}
+
 func (ms meshStub) Emit(name, topic string, payloads ...interface{}) error {
 	return nil
 }
@@ -177,10 +373,42 @@ func (ms meshStub) EmitEvent(name string, evt *Event) error {
 	return nil
 }
 
+func (ms meshStub) Request(ctx context.Context, name, topic string, payloads ...interface{}) (*Event, error) {
+	return nil, nil
+}
+
 func (ms meshStub) Emitter(name string) (Emitter, error) {
 	return nil, nil
 }
 
+func (ms meshStub) Cells() []string {
+	return nil
+}
+
+func (ms meshStub) CellInfo(name string) (CellInfo, error) {
+	return CellInfo{}, nil
+}
+
+func (ms meshStub) Subscribers(name string) ([]string, error) {
+	return nil, nil
+}
+
+func (ms meshStub) Subscriptions(name string) ([]string, error) {
+	return nil, nil
+}
+
+func (ms meshStub) Metrics() []CellMetrics {
+	return nil
+}
+
+func (ms meshStub) Snapshot() error {
+	return nil
+}
+
+func (ms meshStub) Restore() error {
+	return nil
+}
+
 // drop simulates the callback to notify the
 // mesh of the termination of a cell.
 var drop = func() {}
@@ -0,0 +1,323 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//--------------------
+// CLOCK
+//--------------------
+
+// Clock provides the time for a mesh, its cells, and the events
+// they create. Behaviors should use Cell.Clock() instead of the
+// functions of the time package, so that they can be tested with
+// a ManualClock set with WithClock().
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a timer firing once after the duration.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker creates a ticker firing each time the duration
+	// has passed.
+	NewTicker(d time.Duration) Ticker
+
+	// After returns a channel receiving the time after the duration.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel receiving the time when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the
+	// timer already fired or has been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration. It returns
+	// true if the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a ticker created by a Clock.
+type Ticker interface {
+	// C returns the channel receiving the times of the ticks.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// defaultClock is used if no clock is set.
+var defaultClock Clock = realClock{}
+
+//--------------------
+// REAL CLOCK
+//--------------------
+
+// realClock implements Clock using the time package.
+type realClock struct{}
+
+// NewRealClock returns the clock using the time package. It is
+// the default.
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+// Now implements Clock.
+func (c realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer implements Clock.
+func (c realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// NewTicker implements Clock.
+func (c realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// After implements Clock.
+func (c realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// realTimer implements Timer with a time.Timer.
+type realTimer struct {
+	timer *time.Timer
+}
+
+// C implements Timer.
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop implements Timer.
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// Reset implements Timer.
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// realTicker implements Ticker with a time.Ticker.
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+// C implements Ticker.
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+// Stop implements Ticker.
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+//--------------------
+// MANUAL CLOCK
+//--------------------
+
+// ManualClock is a Clock for tests. Its time only changes when it
+// is advanced explicitly, and only then its timers and tickers fire.
+// Like with the time package their channels have a buffer of one,
+// ticks are dropped if a receiver is too slow.
+type ManualClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters map[*manualWaiter]struct{}
+}
+
+// NewManualClock creates a manual clock starting at the given time.
+func NewManualClock(start time.Time) *ManualClock {
+	c := &ManualClock{
+		now:     start,
+		waiters: make(map[*manualWaiter]struct{}),
+	}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements Clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements Clock.
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	return c.newWaiter(d, 0)
+}
+
+// NewTicker implements Clock. It panics for non-positive durations
+// like time.NewTicker().
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return manualTicker{c.newWaiter(d, d)}
+}
+
+// After implements Clock.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// Advance moves the time forward and fires all timers and tickers
+// which are due in the order of their deadlines.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		due := c.due(end)
+		if due == nil {
+			break
+		}
+		c.now = due.deadline
+		due.fire()
+	}
+	c.now = end
+	c.changed.Broadcast()
+}
+
+// Waiters returns the number of active timers and tickers.
+func (c *ManualClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are active.
+// So tests can be sure that a behavior started waiting before they
+// advance the clock.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.changed.Wait()
+	}
+}
+
+// newWaiter creates and registers a timer or ticker.
+func (c *ManualClock) newWaiter(d, period time.Duration) *manualWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &manualWaiter{
+		clock:  c,
+		c:      make(chan time.Time, 1),
+		period: period,
+	}
+	c.schedule(w, d)
+	return w
+}
+
+// schedule sets the deadline of the waiter and registers it. It
+// fires immediately if the duration is not positive.
+func (c *ManualClock) schedule(w *manualWaiter, d time.Duration) {
+	w.deadline = c.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		w.fire()
+		return
+	}
+	c.waiters[w] = struct{}{}
+	c.changed.Broadcast()
+}
+
+// due returns the waiter with the earliest deadline up to the end.
+func (c *ManualClock) due(end time.Time) *manualWaiter {
+	var waiters []*manualWaiter
+	for w := range c.waiters {
+		if !w.deadline.After(end) {
+			waiters = append(waiters, w)
+		}
+	}
+	if len(waiters) == 0 {
+		return nil
+	}
+	sort.Slice(waiters, func(i, j int) bool {
+		return waiters[i].deadline.Before(waiters[j].deadline)
+	})
+	return waiters[0]
+}
+
+// manualWaiter implements Timer for the ManualClock and is the
+// base of its tickers.
+type manualWaiter struct {
+	clock    *ManualClock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+}
+
+// C implements Timer.
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop implements Timer.
+func (w *manualWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, active := w.clock.waiters[w]
+	delete(w.clock.waiters, w)
+	return active
+}
+
+// Reset implements Timer.
+func (w *manualWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, active := w.clock.waiters[w]
+	delete(w.clock.waiters, w)
+	w.clock.schedule(w, d)
+	return active
+}
+
+// manualTicker implements Ticker for the ManualClock.
+type manualTicker struct {
+	*manualWaiter
+}
+
+// Stop implements Ticker.
+func (t manualTicker) Stop() {
+	t.manualWaiter.Stop()
+}
+
+// fire sends the deadline to the channel and reschedules tickers.
+// The clock has to be locked.
+func (w *manualWaiter) fire() {
+	select {
+	case w.c <- w.deadline:
+	default:
+	}
+	if w.period > 0 {
+		w.deadline = w.deadline.Add(w.period)
+		return
+	}
+	delete(w.clock.waiters, w)
+}
+
+// EOF
@@ -0,0 +1,144 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestManualClock verifies the explicit advancing of the manual clock
+// and the firing of its timers and tickers.
+func TestManualClock(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := mesh.NewManualClock(start)
+	assert.Equal(clock.Now(), start)
+
+	timer := clock.NewTimer(time.Second)
+	ticker := clock.NewTicker(400 * time.Millisecond)
+	afterc := clock.After(2 * time.Second)
+	assert.Equal(clock.Waiters(), 3)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(clock.Now(), start.Add(500*time.Millisecond))
+	assert.Equal(<-ticker.C(), start.Add(400*time.Millisecond))
+	assertNotFired(assert, timer.C())
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(<-timer.C(), start.Add(time.Second))
+	assert.Equal(<-ticker.C(), start.Add(800*time.Millisecond))
+	assert.False(timer.Stop())
+	assert.Equal(clock.Waiters(), 2)
+
+	// Slow receivers miss ticks.
+	clock.Advance(time.Second)
+	assert.Equal(<-afterc, start.Add(2*time.Second))
+	assert.Equal(<-ticker.C(), start.Add(1200*time.Millisecond))
+	assertNotFired(assert, ticker.C())
+	ticker.Stop()
+	assert.Equal(clock.Waiters(), 0)
+
+	// Stopped and reset timers.
+	assert.False(timer.Reset(time.Second))
+	assert.True(timer.Stop())
+	clock.Advance(time.Second)
+	assertNotFired(assert, timer.C())
+	timer.Reset(0)
+	assert.Equal(<-timer.C(), start.Add(3*time.Second))
+
+	// Waiting for timers.
+	donec := make(chan struct{})
+	go func() {
+		clock.BlockUntil(1)
+		close(donec)
+	}()
+	assertNotFired(assert, donec)
+	waitc := clock.After(time.Minute)
+	<-donec
+	clock.Advance(time.Minute)
+	assert.Equal(<-waitc, start.Add(time.Minute+3*time.Second))
+}
+
+// TestMeshClock verifies the usage of the clock by the mesh and
+// its cells.
+func TestMeshClock(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := mesh.NewManualClock(start)
+	timestampc := make(chan time.Time, 2)
+	behaviorFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if evt.Topic() == "fail" {
+					return errors.New("failed")
+				}
+				timestampc <- evt.Timestamp()
+				timestampc <- cell.Clock().Now()
+			}
+		}
+	}
+	msh := mesh.New(ctx, mesh.WithClock(clock))
+	assert.NoError(msh.Go("cell", mesh.BehaviorFunc(behaviorFunc), mesh.WithRestartPolicy(mesh.RestartPolicy{
+		Strategy: mesh.RestartOnError,
+		Backoff:  time.Second,
+	})))
+	info, err := msh.CellInfo("cell")
+	assert.NoError(err)
+	assert.Equal(info.StartedAt, start)
+
+	clock.Advance(time.Minute)
+	assert.NoError(msh.Emit("cell", "now"))
+	assert.Equal(<-timestampc, start.Add(time.Minute))
+	assert.Equal(<-timestampc, start.Add(time.Minute))
+
+	// The backoff of the restart waits for the clock.
+	assert.NoError(msh.Emit("cell", "fail"))
+	clock.BlockUntil(1)
+	assert.NoError(msh.Emit("cell", "now"))
+	assertNotFired(assert, timestampc)
+	clock.Advance(time.Second)
+	assert.Equal(<-timestampc, start.Add(time.Minute))
+	assert.Equal(<-timestampc, start.Add(time.Minute+time.Second))
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// assertNotFired checks that the channel does not receive a value
+// within a short time.
+func assertNotFired[T any](assert *asserts.Asserts, c <-chan T) {
+	select {
+	case v := <-c:
+		assert.Fail(fmt.Sprintf("channel received unexpected %v", v))
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// EOF
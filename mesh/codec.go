@@ -0,0 +1,205 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//--------------------
+// CODEC
+//--------------------
+
+// Codec defines the marshalling of event payloads. Codecs are selected
+// per mesh with WithDefaultCodec() or per event with WithCodec(). When
+// events are marshalled into JSON the name of the codec is stored too,
+// so that it can be found again via LookupCodec().
+type Codec interface {
+	// Name returns the unique name of the codec.
+	Name() string
+
+	// Marshal encodes the payload.
+	Marshal(payload interface{}) ([]byte, error)
+
+	// Unmarshal decodes the data into the payload. It has to
+	// be a pointer.
+	Unmarshal(data []byte, payload interface{}) error
+}
+
+// Names of the built-in codecs.
+const (
+	CodecJSON      = "json"
+	CodecGob       = "gob"
+	CodecBinary    = "binary"
+	CodecReference = "reference"
+)
+
+// defaultCodec is used if neither mesh nor event define a codec.
+var defaultCodec Codec = jsonCodec{}
+
+// codecs contains the registered codecs.
+var codecs = struct {
+	mu     sync.RWMutex
+	byName map[string]Codec
+}{
+	byName: map[string]Codec{
+		CodecJSON:   jsonCodec{},
+		CodecGob:    gobCodec{},
+		CodecBinary: binaryCodec{},
+	},
+}
+
+// RegisterCodec registers a codec so that events using it can be
+// unmarshalled from JSON. The built-in codecs are already registered.
+func RegisterCodec(codec Codec) error {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	if codec.Name() == "" || codec.Name() == CodecReference {
+		return fmt.Errorf("invalid codec name '%s'", codec.Name())
+	}
+	if _, ok := codecs.byName[codec.Name()]; ok {
+		return fmt.Errorf("codec '%s' already registered", codec.Name())
+	}
+	codecs.byName[codec.Name()] = codec
+	return nil
+}
+
+// LookupCodec returns the registered codec with the given name.
+func LookupCodec(name string) (Codec, bool) {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	codec, ok := codecs.byName[name]
+	return codec, ok
+}
+
+//--------------------
+// JSON CODEC
+//--------------------
+
+// jsonCodec implements Codec using encoding/json.
+type jsonCodec struct{}
+
+// NewJSONCodec returns the codec using JSON. It is the default.
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+// Name implements Codec.
+func (c jsonCodec) Name() string {
+	return CodecJSON
+}
+
+// Marshal implements Codec.
+func (c jsonCodec) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// Unmarshal implements Codec.
+func (c jsonCodec) Unmarshal(data []byte, payload interface{}) error {
+	return json.Unmarshal(data, payload)
+}
+
+//--------------------
+// GOB CODEC
+//--------------------
+
+// gobCodec implements Codec using encoding/gob.
+type gobCodec struct{}
+
+// NewGobCodec returns the codec using gob. Multiple payloads are
+// encoded as []interface{}, so their types have to be registered
+// with gob.Register() and they have to be read into []interface{}.
+func NewGobCodec() Codec {
+	return gobCodec{}
+}
+
+// Name implements Codec.
+func (c gobCodec) Name() string {
+	return CodecGob
+}
+
+// Marshal implements Codec.
+func (c gobCodec) Marshal(payload interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec.
+func (c gobCodec) Unmarshal(data []byte, payload interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(payload)
+}
+
+//--------------------
+// REFERENCE CODEC
+//--------------------
+
+// referenceCodec passes payloads as Go values and only marshals
+// them with its fallback when needed.
+type referenceCodec struct {
+	fallback Codec
+}
+
+// NewReferenceCodec returns a zero-copy codec for cells running in
+// the same process. Payloads are kept as Go values and handed to
+// Event.Payload() by reference if the types are assignable, so
+// receivers must not modify them. Only when an event leaves the
+// process, e.g. by marshalling it into JSON, or when the types
+// differ, the payload is lazily marshalled using the fallback codec.
+// A nil fallback uses JSON.
+func NewReferenceCodec(fallback Codec) Codec {
+	if fallback == nil {
+		fallback = jsonCodec{}
+	}
+	return referenceCodec{
+		fallback: fallback,
+	}
+}
+
+// Name implements Codec.
+func (c referenceCodec) Name() string {
+	return CodecReference
+}
+
+// Marshal implements Codec using the fallback.
+func (c referenceCodec) Marshal(payload interface{}) ([]byte, error) {
+	return c.fallback.Marshal(payload)
+}
+
+// Unmarshal implements Codec using the fallback.
+func (c referenceCodec) Unmarshal(data []byte, payload interface{}) error {
+	return c.fallback.Unmarshal(data, payload)
+}
+
+// assign sets the payload to the value if it is a pointer to an
+// assignable type.
+func (c referenceCodec) assign(value, payload interface{}) bool {
+	pv := reflect.ValueOf(payload)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() {
+		return false
+	}
+	vv := reflect.ValueOf(value)
+	if !vv.IsValid() || !vv.Type().AssignableTo(pv.Elem().Type()) {
+		return false
+	}
+	pv.Elem().Set(vv)
+	return true
+}
+
+// EOF
@@ -0,0 +1,269 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestCodecs verifies the marshalling and unmarshalling of payloads
+// with the built-in codecs.
+func TestCodecs(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	factor := 1.5
+	payloadIn := testPayload{
+		Name:     "sensor",
+		Count:    -42,
+		Flags:    7,
+		Factor:   &factor,
+		Duration: 1500 * time.Nanosecond,
+		Time:     time.Date(2021, 6, 1, 12, 0, 0, 123, time.UTC),
+		Blob:     []byte{0, 1, 2, 255},
+		Values:   []float32{1.25, -2.5},
+		Labels:   map[string]int{"a": 1, "b": 2},
+		Active:   true,
+	}
+	codecs := []mesh.Codec{
+		mesh.NewJSONCodec(),
+		mesh.NewGobCodec(),
+		mesh.NewBinaryCodec(),
+		mesh.NewReferenceCodec(nil),
+		mesh.NewReferenceCodec(mesh.NewBinaryCodec()),
+	}
+	for _, codec := range codecs {
+		assert.Logf("codec %s", codec.Name())
+		evt, err := mesh.NewEvent("test", payloadIn, mesh.WithCodec(codec))
+		assert.NoError(err)
+		assert.Equal(evt.Codec().Name(), codec.Name())
+		assert.True(evt.HasPayload())
+
+		var payloadOut testPayload
+		assert.NoError(evt.Payload(&payloadOut))
+		assert.Equal(payloadOut, payloadIn)
+
+		// Leave the process via JSON.
+		data, err := json.Marshal(evt)
+		assert.NoError(err)
+		var evtOut mesh.Event
+		assert.NoError(json.Unmarshal(data, &evtOut))
+		payloadOut = testPayload{}
+		assert.NoError(evtOut.Payload(&payloadOut))
+		assert.Equal(payloadOut, payloadIn)
+	}
+}
+
+// TestBinaryCodec verifies special cases of the binary codec.
+func TestBinaryCodec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	codec := mesh.NewBinaryCodec()
+
+	evt, err := mesh.NewEvent("test", 1, 2, 3, mesh.WithCodec(codec))
+	assert.NoError(err)
+	ints := []int{}
+	assert.NoError(evt.Payload(&ints))
+	assert.Equal(ints, []int{1, 2, 3})
+
+	data, err := codec.Marshal(uint64(300))
+	assert.NoError(err)
+	assert.Length(data, 2)
+	var small uint8
+	assert.ErrorContains(codec.Unmarshal(data, &small), "overflows")
+	var s string
+	assert.ErrorContains(codec.Unmarshal(data, &s), "unexpected end of data")
+	var iface interface{}
+	assert.ErrorContains(codec.Unmarshal(data, &iface), "cannot unmarshal type")
+	assert.ErrorContains(codec.Unmarshal(data, small), "cannot unmarshal into")
+
+	// Truncated and oversized lengths.
+	type elem struct{ A, B int }
+	data, err = codec.Marshal([]elem{{1, 2}, {3, 4}})
+	assert.NoError(err)
+	var elems []elem
+	assert.NoError(codec.Unmarshal(data, &elems))
+	assert.Equal(elems, []elem{{1, 2}, {3, 4}})
+	assert.ErrorContains(codec.Unmarshal(data[:2], &elems), "unexpected end of data")
+	assert.ErrorContains(codec.Unmarshal([]byte{0x7f, 0x01}, &elems), "unexpected end of data")
+	assert.ErrorContains(codec.Unmarshal([]byte{0x7f, 0x01}, &[][2]int{}), "unexpected end of data")
+	assert.ErrorContains(codec.Unmarshal([]byte{0x7f, 0x01}, &map[string]int{}), "unexpected end of data")
+	oversized := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	assert.ErrorContains(codec.Unmarshal(oversized, &elems), "too large")
+	assert.ErrorContains(codec.Unmarshal(oversized, &s), "too large")
+	assert.ErrorContains(codec.Unmarshal(oversized, &map[string]int{}), "too large")
+
+	// Slices of zero-size elements.
+	type hidden struct{ a int }
+	empties := []struct{}{{}, {}, {}}
+	data, err = codec.Marshal(empties)
+	assert.NoError(err)
+	var emptiesOut []struct{}
+	assert.NoError(codec.Unmarshal(data, &emptiesOut))
+	assert.Length(emptiesOut, 3)
+	data, err = codec.Marshal([]hidden{{1}, {2}})
+	assert.NoError(err)
+	var hiddenOut []hidden
+	assert.NoError(codec.Unmarshal(data, &hiddenOut))
+	assert.Equal(hiddenOut, []hidden{{}, {}})
+	data, err = codec.Marshal([][0]int{{}, {}})
+	assert.NoError(err)
+	var arraysOut [][0]int
+	assert.NoError(codec.Unmarshal(data, &arraysOut))
+	assert.Length(arraysOut, 2)
+
+	_, err = codec.Marshal(nil)
+	assert.ErrorContains(err, "cannot marshal nil")
+	_, err = codec.Marshal(make(chan int))
+	assert.ErrorContains(err, "cannot marshal type")
+
+	// Compact compared to JSON.
+	payload := testPayload{Name: "compact", Count: 1, Labels: map[string]int{"a": 1}}
+	binData, err := codec.Marshal(payload)
+	assert.NoError(err)
+	jsonData, err := mesh.NewJSONCodec().Marshal(payload)
+	assert.NoError(err)
+	assert.True(len(binData) < len(jsonData)/3)
+}
+
+// TestReferenceCodec verifies the zero-copy passing of payloads.
+func TestReferenceCodec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	payloadIn := &testPayload{Name: "shared"}
+
+	evt, err := mesh.NewEvent("test", payloadIn, mesh.WithCodec(mesh.NewReferenceCodec(nil)))
+	assert.NoError(err)
+	var payloadOut *testPayload
+	assert.NoError(evt.Payload(&payloadOut))
+	assert.True(payloadOut == payloadIn)
+
+	// Not assignable types are marshalled.
+	var generic map[string]interface{}
+	assert.NoError(evt.Payload(&generic))
+	assert.Equal(generic["Name"], "shared")
+
+	// The JSON encoding uses the fallback codec.
+	data, err := json.Marshal(evt)
+	assert.NoError(err)
+	assert.Contains(`"payload":{"Name":"shared"`, string(data))
+	assert.False(strings.Contains(string(data), `"codec"`))
+}
+
+// TestRegisterCodec verifies the registration of custom codecs.
+func TestRegisterCodec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	assert.ErrorContains(mesh.RegisterCodec(mesh.NewGobCodec()), "codec 'gob' already registered")
+	assert.ErrorContains(mesh.RegisterCodec(mesh.NewReferenceCodec(nil)), "invalid codec name 'reference'")
+	assert.NoError(mesh.RegisterCodec(upperCodec{}))
+	codec, ok := mesh.LookupCodec("upper")
+	assert.True(ok)
+	assert.Equal(codec.Name(), "upper")
+
+	evt, err := mesh.NewEvent("test", "payload", mesh.WithCodec(upperCodec{}))
+	assert.NoError(err)
+	data, err := json.Marshal(evt)
+	assert.NoError(err)
+	assert.Contains(`"codec":"upper"`, string(data))
+	var evtOut mesh.Event
+	assert.NoError(json.Unmarshal(data, &evtOut))
+	var s string
+	assert.NoError(evtOut.Payload(&s))
+	assert.Equal(s, "PAYLOAD")
+
+	assert.ErrorContains(json.Unmarshal([]byte(`{"topic":"x","codec":"unknown","payload":"AA=="}`), &evtOut),
+		"codec 'unknown' is not registered")
+}
+
+// TestMeshDefaultCodec verifies the codec set for a whole mesh.
+func TestMeshDefaultCodec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	behaviorFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if evt.Topic() == "forward" {
+					out.Emit("forwarded", 1)
+					continue
+				}
+				sigc <- evt.Topic() + ":" + evt.Codec().Name()
+			}
+		}
+	}
+	msh := mesh.New(ctx, mesh.WithDefaultCodec(mesh.NewBinaryCodec()))
+	msh.Go("forwarder", mesh.BehaviorFunc(behaviorFunc))
+	msh.Go("receiver", mesh.BehaviorFunc(behaviorFunc))
+	msh.Subscribe("forwarder", "receiver")
+
+	assert.NoError(msh.Emit("receiver", "direct", 1))
+	assert.Wait(sigc, "direct:binary", time.Second)
+	assert.NoError(msh.Emit("receiver", "own", 1, mesh.WithCodec(mesh.NewGobCodec())))
+	assert.Wait(sigc, "own:gob", time.Second)
+	assert.NoError(msh.Emit("forwarder", "forward"))
+	assert.Wait(sigc, "forwarded:binary", time.Second)
+
+	cancel()
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// testPayload is used for testing the codecs.
+type testPayload struct {
+	Name     string
+	Count    int
+	Flags    uint16
+	Factor   *float64
+	Duration time.Duration
+	Time     time.Time
+	Blob     []byte
+	Values   []float32
+	Labels   map[string]int
+	Active   bool
+}
+
+// upperCodec is a custom codec storing strings in upper case.
+type upperCodec struct{}
+
+func (c upperCodec) Name() string {
+	return "upper"
+}
+
+func (c upperCodec) Marshal(payload interface{}) ([]byte, error) {
+	return mesh.NewJSONCodec().Marshal(payload)
+}
+
+func (c upperCodec) Unmarshal(data []byte, payload interface{}) error {
+	if err := mesh.NewJSONCodec().Unmarshal(data, payload); err != nil {
+		return err
+	}
+	if s, ok := payload.(*string); ok {
+		*s = strings.ToUpper(*s)
+	}
+	return nil
+}
+
+// EOF
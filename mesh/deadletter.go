@@ -0,0 +1,160 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//--------------------
+// DEAD LETTER
+//--------------------
+
+// DeadLetter contains an event which could not be delivered to a
+// subscribed cell, e.g. because it has been deactivated or its queue
+// timed out. It is also the payload of the events with the topic
+// TopicDeadLetter sent to a dead-letter cell. Attempts counts the
+// failed deliveries. It starts at 1 and is increased by each failed
+// replay of a DeadLetterQueue.
+type DeadLetter struct {
+	Event     *Event    `json:"event"`
+	Emitter   string    `json:"emitter"`
+	Target    string    `json:"target"`
+	Reason    string    `json:"reason"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReplayDeadLetter delivers the event of the dead letter again to
+// its target cell. The event is emitted via the mesh. A failing
+// delivery is returned as error and does not create a new dead
+// letter, so the caller cares for the number of attempts.
+func ReplayDeadLetter(msh Mesh, dl DeadLetter) error {
+	if dl.Event == nil {
+		return fmt.Errorf("dead letter for cell '%s' contains no event", dl.Target)
+	}
+	// Copy the event, it may be shared with other cells.
+	return msh.EmitEvent(dl.Target, dl.Event.With())
+}
+
+// DeadLetterSink receives the dead letters of a mesh. It is called by
+// the emitting cell, so it should not block it for long.
+type DeadLetterSink interface {
+	// DeadLetter handles one dead letter.
+	DeadLetter(dl DeadLetter)
+}
+
+// DeadLetterFunc is a function implementing DeadLetterSink.
+type DeadLetterFunc func(dl DeadLetter)
+
+// DeadLetter implements DeadLetterSink.
+func (f DeadLetterFunc) DeadLetter(dl DeadLetter) {
+	f(dl)
+}
+
+// deadLetterConfig contains the sink and the cell receiving the
+// dead letters.
+type deadLetterConfig struct {
+	sink DeadLetterSink
+	cell string
+}
+
+// deadLetter passes a dead letter to the configured sink and cell.
+// Dead letters of the dead-letter cell itself are not sent to it again.
+func (m *mesh) deadLetter(dl DeadLetter) {
+	if m.cfg.deadLetters.sink != nil {
+		m.cfg.deadLetters.sink.DeadLetter(dl)
+	}
+	name := m.cfg.deadLetters.cell
+	if name == "" || dl.Target == name {
+		return
+	}
+	evt, err := m.newEvent(TopicDeadLetter, dl)
+	if err == nil {
+		err = m.EmitEvent(name, evt)
+	}
+	if err != nil {
+		m.cfg.logger.Error("cannot send dead letter", "cell", name, "target", dl.Target, "error", err)
+	}
+}
+
+//--------------------
+// DEAD LETTER QUEUE
+//--------------------
+
+// DeadLetterQueue is a DeadLetterSink keeping the dead letters in
+// memory until they are replayed.
+type DeadLetterQueue struct {
+	mu      sync.Mutex
+	max     int
+	letters []DeadLetter
+}
+
+// NewDeadLetterQueue creates a dead letter queue. If the maximum
+// number of dead letters is reached the oldest ones are removed, a
+// maximum of zero or less means unlimited.
+func NewDeadLetterQueue(max int) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		max: max,
+	}
+}
+
+// DeadLetter implements DeadLetterSink.
+func (q *DeadLetterQueue) DeadLetter(dl DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.letters = append(q.letters, dl)
+	if q.max > 0 && len(q.letters) > q.max {
+		q.letters = q.letters[len(q.letters)-q.max:]
+	}
+}
+
+// Len returns the number of dead letters.
+func (q *DeadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.letters)
+}
+
+// DeadLetters returns a copy of the dead letters in their order.
+func (q *DeadLetterQueue) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.letters...)
+}
+
+// Replay delivers the events of all dead letters again to their
+// targets. Dead letters failing again stay in the queue with the
+// new reason and an increased number of attempts.
+func (q *DeadLetterQueue) Replay(msh Mesh) error {
+	q.mu.Lock()
+	letters := q.letters
+	q.letters = nil
+	q.mu.Unlock()
+	failed := 0
+	for _, dl := range letters {
+		if err := ReplayDeadLetter(msh, dl); err != nil {
+			dl.Reason = err.Error()
+			dl.Attempts++
+			q.DeadLetter(dl)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d dead letters not delivered", failed, len(letters))
+	}
+	return nil
+}
+
+// EOF
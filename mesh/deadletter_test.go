@@ -0,0 +1,102 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestDeadLetters verifies the delivery to the other subscribers and
+// the handling of undeliverable events.
+func TestDeadLetters(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	queue := mesh.NewDeadLetterQueue(10)
+	releasec := make(chan struct{})
+	blockFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		<-releasec
+		return forwardFunc(cell, in, out)
+	}
+	itb := mesh.NewIntegrationTestbed(mesh.WithDeadLetters(queue), mesh.WithDeadLetterCell("dead"))
+	defer itb.Stop()
+	assert.NoError(itb.Go("emit", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Go("ok", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Go("blocked", mesh.BehaviorFunc(blockFunc),
+		mesh.WithQueue(1, mesh.QueueBlock),
+		mesh.WithQueueTimeout(10*time.Millisecond),
+	))
+	assert.NoError(itb.Go("dead", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Subscribe("emit", "ok"))
+	assert.NoError(itb.Subscribe("emit", "blocked"))
+	assert.NoError(itb.Capture("ok", "blocked", "dead"))
+
+	// Second event times out at the blocked cell but reaches the other one.
+	assert.NoError(itb.Emit("emit", "a"))
+	assert.NoError(itb.Emit("emit", "b"))
+	assert.NoError(itb.WaitForTopics("ok", []string{"a", "b"}, time.Second))
+	evt, err := itb.WaitForTopic("dead", mesh.TopicDeadLetter, time.Second)
+	assert.NoError(err)
+	var dl mesh.DeadLetter
+	assert.NoError(evt.Payload(&dl))
+	assert.Equal(dl.Event.Topic(), "b")
+	assert.Equal(dl.Emitter, "emit")
+	assert.Equal(dl.Target, "blocked")
+	assert.Equal(dl.Attempts, 1)
+	assert.Equal(dl.Reason, "queue of cell 'blocked' overflow: timeout after waiting for space")
+
+	assert.Equal(queue.Len(), 1)
+	dls := queue.DeadLetters()
+	assert.Equal(dls[0].Event.Topic(), "b")
+	assert.Equal(dls[0].Target, "blocked")
+	for _, cm := range itb.Mesh().Metrics() {
+		if cm.Name == "emit" {
+			assert.Equal(cm.Undelivered, uint64(1))
+		}
+	}
+
+	// Replay fails while the cell is still blocked.
+	assert.ErrorContains(queue.Replay(itb.Mesh()), "1 of 1 dead letters not delivered")
+	dls = queue.DeadLetters()
+	assert.Length(dls, 1)
+	assert.Equal(dls[0].Attempts, 2)
+
+	// Replay succeeds after the cell is released.
+	close(releasec)
+	assert.NoError(itb.WaitForTopics("blocked", []string{"a"}, time.Second))
+	assert.NoError(queue.Replay(itb.Mesh()))
+	assert.Equal(queue.Len(), 0)
+	assert.NoError(itb.WaitForTopics("blocked", []string{"a", "b"}, time.Second))
+}
+
+// TestDeadLetterQueueMax verifies the limit of the dead letter queue.
+func TestDeadLetterQueueMax(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	queue := mesh.NewDeadLetterQueue(2)
+	for _, target := range []string{"a", "b", "c"} {
+		queue.DeadLetter(mesh.DeadLetter{Target: target})
+	}
+	dls := queue.DeadLetters()
+	assert.Length(dls, 2)
+	assert.Equal(dls[0].Target, "b")
+	assert.Equal(dls[1].Target, "c")
+	assert.ErrorContains(mesh.ReplayDeadLetter(nil, dls[0]), "dead letter for cell 'b' contains no event")
+}
+
+// EOF
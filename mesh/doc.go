@@ -17,12 +17,34 @@
 //
 //     msh := mesh.New()
 //
+// Payloads are marshalled into JSON by default. Other codecs can be set
+// for the whole mesh with
+//
+//     msh := mesh.New(ctx, mesh.WithDefaultCodec(mesh.NewBinaryCodec()))
+//
+// or for single events with the option mesh.WithCodec(). The codec of
+// mesh.NewReferenceCodec() passes payloads between cells by reference.
+//
 // and cells are started with
 //
 //    msh.Go("foo", NewFooBehavior())
 //    msh.Go("bar", NewBarBehavior())
 //    msh.Go("baz", NewBazBehavior())
 //
+// Options configure the started cells, e.g. they can be supervised
+// and restarted when their behavior fails with
+//
+//    msh.Go("foo", NewFooBehavior(), mesh.WithRestartPolicy(mesh.RestartPolicy{
+//        Strategy:    mesh.RestartOnError,
+//        MaxRestarts: 5,
+//        Window:      time.Minute,
+//        Backoff:     100 * time.Millisecond,
+//    }))
+//
+// or get an individual input queue with
+//
+//    msh.Go("bar", NewBarBehavior(), mesh.WithQueue(1024, mesh.QueueDropOldest))
+//
 // These cells can subscribe each other with
 //
 //    msh.Subscribe("foo", "bar")
@@ -31,12 +53,27 @@
 // so that events which are emitted by the cell "foo" will be
 // received by the cells "bar" and "baz". Each cell can subscribe
 // to multiple other subscribers and even circular subscriptions are
-// no problem. But handle with care.
+// no problem. But handle with care. Subscriptions can be limited
+// to events with matching topics, e.g.
+//
+//    msh.SubscribeTopics("foo", "bar", "sensor.*.temp", "alarm.**")
+//
+// Each subscriber gets the events of a cell in the order they are
+// emitted through an own lane. So a slow subscriber does not block
+// the delivery to the others as long as its queue has space. The
+// events in the lanes count for the queue size, if it is full the
+// queue policy of the subscriber is applied like for events emitted
+// via the mesh.
 //
 // Events from the outside are emitted using
 //
 //     msh.Emit("foo", "topic", 42)
 //
+// Options passed together with the payloads add metadata to the
+// event, e.g.
+//
+//     msh.Emit("foo", "topic", 42, mesh.WithHeader("tenant", "acme"))
+//
 // In case of many emits to one cell you can get an emitter
 // with
 //
@@ -46,6 +83,87 @@
 //
 //     emtrEmit(mesh.NewEvent("foo", "answer", 42))
 //
+// Typed payloads are created and read with
+//
+//     evt, err := mesh.NewTypedEvent("reading", Reading{Value: 21.5})
+//     reading, err := mesh.PayloadAs[Reading](evt)
+//
+// Cells can also be asked with
+//
+//     reply, err := msh.Request(ctx, "foo", "question", 42)
+//
+// Their behaviors answer such events with
+//
+//     if evt.IsRequest() {
+//         err := evt.Reply("answer", 4711)
+//     }
+//
+// Single cells are stopped with
+//
+//     err := msh.Stop("foo")
+//
+// while
+//
+//     err := msh.Shutdown(ctx)
+//
+// stops all cells after their queued events have been processed.
+//
+// Behaviors take the time from cell.Clock(). Tests of time-aware
+// behaviors can set a manual clock and advance it explicitly with
+//
+//     clock := mesh.NewManualClock(start)
+//     msh := mesh.New(ctx, mesh.WithClock(clock))
+//     clock.Advance(time.Minute)
+//
+// Cross-cutting concerns like authorization, validation, or sampling
+// are added as interceptors for all cells of the mesh or for single
+// cells. They can observe, change, drop, or reject the events.
+//
+//     authorize := func(cell string, point mesh.InterceptionPoint, evt *mesh.Event) (*mesh.Event, error) {
+//         if _, ok := evt.Header("tenant"); !ok {
+//             return nil, errors.New("missing tenant")
+//         }
+//         return evt, nil
+//     }
+//     msh := mesh.New(ctx, mesh.WithInterceptors(authorize))
+//
+// The states of behaviors implementing Snapshotter, e.g. counters
+// or aggregators, survive restarts with a snapshot store. They are
+// restored when the cells are started and saved every 5 minutes and
+// at shutdown with
+//
+//     store, err := mesh.NewFileSnapshotStore("/var/lib/cells")
+//     msh := mesh.New(ctx, mesh.WithSnapshots(store, 5*time.Minute))
+//
+// Each cell counts its received, emitted, and dropped events, its errors
+// and restarts, and measures the processing times of its behavior and
+// the times emitters wait for space in its queue. Mesh.Metrics() returns
+// them for all cells, the package metrics serves them for Prometheus.
+//
+// With a tracer each emitting and processing of an event becomes a span.
+// The span context is propagated with the events, so the path shown by
+// Event.Emitters() becomes a timed trace. The MemoryTracer records the
+// spans for tests, the package tracing adapts OpenTelemetry.
+//
+//     msh := mesh.New(ctx, mesh.WithTracer(mesh.NewMemoryTracer()))
+//
+// A structured logger, e.g. a *slog.Logger or the text logger of
+// this package, gets the lifecycle of the cells, their subscription
+// changes, and the events lost by full queues. Behaviors log via
+// Cell.Logger(), tagged with the cell name and the behavior type.
+//
+//     msh := mesh.New(ctx, mesh.WithLogger(mesh.NewTextLogger(os.Stderr, mesh.LogInfo)))
+//
+// Events which cannot be delivered to a subscriber, e.g. due to a
+// timeout of its queue, do not stop the delivery to the others. They
+// become dead letters passed to a sink or a dead-letter cell and can
+// be replayed later.
+//
+//     deadLetters := mesh.NewDeadLetterQueue(1000)
+//     msh := mesh.New(ctx, mesh.WithDeadLetters(deadLetters))
+//     ...
+//     err := deadLetters.Replay(msh)
+//
 package mesh // import "tideland.dev/go/cells/mesh"
 
 // EOF
@@ -12,52 +12,180 @@ package mesh // import "tideland.dev/go/cells/mesh"
 //--------------------
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+//--------------------
+// EVENT IDS
+//--------------------
+
+var (
+	// idPrefix makes the event IDs of this process unique.
+	idPrefix = newIDPrefix()
+
+	// idCounter makes the event IDs inside this process unique.
+	idCounter uint64
+)
+
+// newIDPrefix creates the random prefix of the event IDs.
+func newIDPrefix() []byte {
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		binary.BigEndian.PutUint64(prefix, uint64(time.Now().UnixNano()))
+	}
+	return prefix
+}
+
+// newEventID creates a new unique event ID.
+func newEventID() string {
+	id := make([]byte, 16)
+	copy(id, idPrefix)
+	binary.BigEndian.PutUint64(id[8:], atomic.AddUint64(&idCounter, 1))
+	return hex.EncodeToString(id)
+}
+
+//--------------------
+// EVENT OPTIONS
+//--------------------
+
+// EventOption defines a function setting an option of an event
+// when it is created with NewEvent(). Options can be passed mixed
+// with the payloads.
+type EventOption func(evt *Event)
+
+// WithCorrelationID sets the correlation ID of the event. Events
+// emitted by behaviors while processing an event inherit its
+// correlation ID if they have none.
+func WithCorrelationID(id string) EventOption {
+	return func(evt *Event) {
+		evt.correlationID = id
+	}
+}
+
+// WithCodec sets the codec used for the payloads of the event. By
+// default it is JSON or the default codec of the mesh.
+func WithCodec(codec Codec) EventOption {
+	return func(evt *Event) {
+		evt.codec = codec
+	}
+}
+
+// WithTimestamp sets the timestamp of the event. By default it is
+// the current time of the clock of the mesh.
+func WithTimestamp(t time.Time) EventOption {
+	return func(evt *Event) {
+		evt.timestamp = t.UTC()
+	}
+}
+
+// WithSpanContext sets the span context of the event, e.g. to
+// continue a trace started outside of the mesh. Events emitted by
+// behaviors while processing an event inherit its span context.
+func WithSpanContext(sc SpanContext) EventOption {
+	return func(evt *Event) {
+		evt.spanContext = sc
+	}
+}
+
+// WithHeader sets one metadata header of the event.
+func WithHeader(key, value string) EventOption {
+	return func(evt *Event) {
+		if evt.headers == nil {
+			evt.headers = make(map[string]string)
+		}
+		evt.headers[key] = value
+	}
+}
+
+// WithHeaders sets multiple metadata headers of the event.
+func WithHeaders(headers map[string]string) EventOption {
+	return func(evt *Event) {
+		for key, value := range headers {
+			WithHeader(key, value)(evt)
+		}
+	}
+}
+
 //--------------------
 // EVENT
 //--------------------
 
 // Event transports a topic and a payload a cell can process. The
-// payload is anything marshalled into JSON and will be unmarshalled
-// when a receiving cell accesses it.
+// payload is anything marshalled with the codec of the event, by
+// default JSON, and will be unmarshalled when a receiving cell
+// accesses it. Each event has a unique ID.
+// The optional correlation ID groups events belonging together, the
+// causation ID is the ID of the event which has been processed by a
+// behavior when it emitted this one. Headers contain metadata
+// like tenant or schema version outside of the payload.
 type Event struct {
-	timestamp time.Time
-	emitters  []string
-	topic     string
-	payload   json.RawMessage
+	timestamp     time.Time
+	id            string
+	correlationID string
+	causationID   string
+	spanContext   SpanContext
+	headers       map[string]string
+	emitters      []string
+	topic         string
+	codec         Codec
+	payload       []byte
+	value         interface{}
+	byReference   bool
+	replier       *replier
 }
 
 // NewEvent creates a new Event based on a topic. The payloads are optional.
+// Event options like WithCorrelationID(), WithHeader(), or WithCodec() can
+// be passed together with the payloads, they are not marshalled.
 func NewEvent(topic string, payloads ...interface{}) (*Event, error) {
 	if topic == "" {
 		return nil, fmt.Errorf("event needs topic")
 	}
 	evt := &Event{
 		timestamp: time.Now().UTC(),
+		id:        newEventID(),
 		topic:     topic,
+		codec:     defaultCodec,
 	}
+	// Separate options from payloads.
+	values := payloads[:0:0]
+	for _, payload := range payloads {
+		if option, ok := payload.(EventOption); ok {
+			option(evt)
+			continue
+		}
+		values = append(values, payload)
+	}
+	payloads = values
 	// Check if the only value is a payload.
+	var value interface{}
 	switch len(payloads) {
 	case 0:
 		return evt, nil
 	case 1:
-		bs, err := json.Marshal(payloads[0])
-		if err != nil {
-			return evt, fmt.Errorf("cannot marshal payload: %v", err)
-		}
-		evt.payload = bs
+		value = payloads[0]
 	default:
-		bs, err := json.Marshal(payloads)
-		if err != nil {
-			return evt, fmt.Errorf("cannot marshal payload: %v", err)
-		}
-		evt.payload = bs
+		value = payloads
+	}
+	if _, ok := evt.codec.(referenceCodec); ok {
+		evt.value = value
+		evt.byReference = true
+		return evt, nil
 	}
+	bs, err := evt.codec.Marshal(value)
+	if err != nil {
+		return evt, fmt.Errorf("cannot marshal payload: %v", err)
+	}
+	evt.payload = bs
 	return evt, nil
 }
 
@@ -66,6 +194,47 @@ func (evt Event) Timestamp() time.Time {
 	return evt.timestamp
 }
 
+// ID returns the unique event ID.
+func (evt Event) ID() string {
+	return evt.id
+}
+
+// CorrelationID returns the correlation ID of the event. It is
+// empty if none has been set or inherited.
+func (evt Event) CorrelationID() string {
+	return evt.correlationID
+}
+
+// CausationID returns the ID of the event which caused this one.
+// It is empty if the event has not been emitted by a behavior while
+// processing another event.
+func (evt Event) CausationID() string {
+	return evt.causationID
+}
+
+// SpanContext returns the span context of the event. With a tracer
+// it is the one of the span emitting the event or, while a behavior
+// processes it, the one of the processing span.
+func (evt Event) SpanContext() SpanContext {
+	return evt.spanContext
+}
+
+// Header returns the value of the header with the given key and
+// if it exists.
+func (evt Event) Header(key string) (string, bool) {
+	value, ok := evt.headers[key]
+	return value, ok
+}
+
+// Headers returns a copy of all headers of the event.
+func (evt Event) Headers() map[string]string {
+	headers := make(map[string]string, len(evt.headers))
+	for key, value := range evt.headers {
+		headers[key] = value
+	}
+	return headers
+}
+
 // Emitters returns an emitters path aloowing to see
 // where an event has been emitted or simply re-emitted.
 // The path layouts are
@@ -77,57 +246,172 @@ func (evt Event) Timestamp() time.Time {
 //
 // So also longer paths like /foo/bar/baz are possible.
 func (evt Event) Emitters() string {
-	if len(evt.emitters) == 1 {
+	switch len(evt.emitters) {
+	case 0:
+		return ""
+	case 1:
 		return evt.emitters[0]
 	}
 	return evt.emitters[0] + strings.Join(evt.emitters[1:], "/")
 }
 
+// Derive creates a new event with the given topic but the payload,
+// the headers, the correlation ID, the span context, the codec, and
+// the timestamp of this event. So derived events follow the clock
+// of the mesh too. The payload is not marshalled again.
+func (evt Event) Derive(topic string) (*Event, error) {
+	derived, err := NewEvent(topic,
+		WithCorrelationID(evt.correlationID),
+		WithHeaders(evt.headers),
+		WithTimestamp(evt.timestamp),
+	)
+	if err != nil {
+		return nil, err
+	}
+	derived.spanContext = evt.spanContext
+	derived.codec = evt.codec
+	derived.payload = evt.payload
+	derived.value = evt.value
+	derived.byReference = evt.byReference
+	return derived, nil
+}
+
+// With returns a copy of the event with the options applied, e.g.
+// to add headers. ID, payload, and reply address stay the same.
+func (evt Event) With(options ...EventOption) *Event {
+	changed := evt
+	changed.headers = evt.Headers()
+	changed.emitters = append([]string(nil), evt.emitters...)
+	for _, option := range options {
+		option(&changed)
+	}
+	return &changed
+}
+
 // Topic returns the event topic.
 func (evt Event) Topic() string {
 	return evt.topic
 }
 
+// Codec returns the codec of the event payload.
+func (evt Event) Codec() Codec {
+	if evt.codec == nil {
+		return defaultCodec
+	}
+	return evt.codec
+}
+
 // HasPayload checks if the event contains a payload.
 func (evt Event) HasPayload() bool {
-	return evt.payload != nil
+	return evt.payload != nil || evt.byReference
 }
 
-// Payload unmarshals the payload of the event.
+// Payload unmarshals the payload of the event. In case of the
+// reference codec the payload is directly assigned if possible.
 func (evt Event) Payload(payload interface{}) error {
-	if evt.payload == nil {
+	if !evt.HasPayload() {
 		return fmt.Errorf("Event contains no payload")
 	}
-	err := json.Unmarshal(evt.payload, payload)
+	if evt.byReference {
+		rc := evt.codec.(referenceCodec)
+		if rc.assign(evt.value, payload) {
+			return nil
+		}
+	}
+	codec, data, err := evt.marshalled()
+	if err != nil {
+		return err
+	}
+	err = codec.Unmarshal(data, payload)
 	if err != nil {
 		return fmt.Errorf("cannont unmarshal payload: %v", err)
 	}
 	return nil
 }
 
+// IsRequest checks if the event has been emitted with Mesh.Request()
+// and waits for a reply.
+func (evt Event) IsRequest() bool {
+	return evt.replier != nil
+}
+
+// Reply creates an event and sends it as answer to the requester.
+// It uses the codec of the request if none is passed.
+func (evt Event) Reply(topic string, payloads ...interface{}) error {
+	payloads = append([]interface{}{WithCodec(evt.Codec())}, payloads...)
+	reply, err := NewEvent(topic, payloads...)
+	if err != nil {
+		return err
+	}
+	return evt.ReplyEvent(reply)
+}
+
+// ReplyEvent sends the event as answer to the requester. The request
+// becomes the cause of the reply. Only one
+// reply per request is possible, and replies to requests whose
+// requester stopped waiting are silently dropped.
+func (evt Event) ReplyEvent(reply *Event) error {
+	if evt.replier == nil {
+		return errors.New("event is no request")
+	}
+	reply.initCause(&evt)
+	return evt.replier.reply(reply)
+}
+
 // String implements fmt.Stringer.
 func (evt Event) String() string {
 	return fmt.Sprintf(
-		"Event{Timestamp:%s Emitters:%v Topic:%v Payload:%v}",
+		"Event{Timestamp:%s ID:%s CorrelationID:%s CausationID:%s Headers:%v Emitters:%v Topic:%v Payload:%v}",
 		evt.timestamp.Format(time.RFC3339Nano),
+		evt.id,
+		evt.correlationID,
+		evt.causationID,
+		evt.headers,
 		evt.emitters,
 		evt.topic,
-		string(evt.payload),
+		evt.payloadString(),
 	)
 }
 
 // MarshalJSON implements the custom JSON marshaling of the event.
 func (evt Event) MarshalJSON() ([]byte, error) {
 	tmp := struct {
-		Timestamp time.Time       `json:"timestamp"`
-		Emitters  []string        `json:"emitters,omitempty"`
-		Topic     string          `json:"topic"`
-		Payload   json.RawMessage `json:"payload,omitempty"`
+		Timestamp     time.Time         `json:"timestamp"`
+		ID            string            `json:"id,omitempty"`
+		CorrelationID string            `json:"correlationId,omitempty"`
+		CausationID   string            `json:"causationId,omitempty"`
+		SpanContext   *SpanContext      `json:"spanContext,omitempty"`
+		Headers       map[string]string `json:"headers,omitempty"`
+		Emitters      []string          `json:"emitters,omitempty"`
+		Topic         string            `json:"topic"`
+		Codec         string            `json:"codec,omitempty"`
+		Payload       json.RawMessage   `json:"payload,omitempty"`
 	}{
-		Timestamp: evt.timestamp,
-		Emitters:  evt.emitters,
-		Topic:     evt.topic,
-		Payload:   evt.payload,
+		Timestamp:     evt.timestamp,
+		ID:            evt.id,
+		CorrelationID: evt.correlationID,
+		CausationID:   evt.causationID,
+		Headers:       evt.headers,
+		Emitters:      evt.emitters,
+		Topic:         evt.topic,
+	}
+	if evt.spanContext.IsValid() {
+		tmp.SpanContext = &evt.spanContext
+	}
+	if evt.HasPayload() {
+		// JSON payloads are embedded, all others are
+		// stored as base64 string together with the codec.
+		codec, data, err := evt.marshalled()
+		if err != nil {
+			return nil, err
+		}
+		if codec.Name() != CodecJSON {
+			tmp.Codec = codec.Name()
+			if data, err = json.Marshal(data); err != nil {
+				return nil, err
+			}
+		}
+		tmp.Payload = data
 	}
 	return json.Marshal(tmp)
 }
@@ -135,30 +419,142 @@ func (evt Event) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON implements the custom JSON unmarshaling of the event.
 func (evt *Event) UnmarshalJSON(data []byte) error {
 	tmp := struct {
-		Timestamp time.Time       `json:"timestamp"`
-		Emitters  []string        `json:"emitters,omitempty"`
-		Topic     string          `json:"topic"`
-		Payload   json.RawMessage `json:"payload,omitempty"`
+		Timestamp     time.Time         `json:"timestamp"`
+		ID            string            `json:"id,omitempty"`
+		CorrelationID string            `json:"correlationId,omitempty"`
+		CausationID   string            `json:"causationId,omitempty"`
+		SpanContext   *SpanContext      `json:"spanContext,omitempty"`
+		Headers       map[string]string `json:"headers,omitempty"`
+		Emitters      []string          `json:"emitters,omitempty"`
+		Topic         string            `json:"topic"`
+		Codec         string            `json:"codec,omitempty"`
+		Payload       json.RawMessage   `json:"payload,omitempty"`
 	}{}
 	if err := json.Unmarshal(data, &tmp); err != nil {
 		return err
 	}
 	evt.timestamp = tmp.Timestamp
+	evt.id = tmp.ID
+	evt.correlationID = tmp.CorrelationID
+	evt.causationID = tmp.CausationID
+	evt.spanContext = SpanContext{}
+	if tmp.SpanContext != nil {
+		evt.spanContext = *tmp.SpanContext
+	}
+	evt.headers = tmp.Headers
 	evt.emitters = tmp.Emitters
 	evt.topic = tmp.Topic
-	evt.payload = tmp.Payload
+	evt.codec = defaultCodec
+	evt.payload = nil
+	evt.value = nil
+	evt.byReference = false
+	if tmp.Codec != "" && tmp.Codec != CodecJSON {
+		codec, ok := LookupCodec(tmp.Codec)
+		if !ok {
+			return fmt.Errorf("codec '%s' is not registered", tmp.Codec)
+		}
+		evt.codec = codec
+		if tmp.Payload != nil {
+			if err := json.Unmarshal(tmp.Payload, &evt.payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if tmp.Payload != nil {
+		evt.payload = []byte(tmp.Payload)
+	}
 	return nil
 }
 
+// marshalled returns the marshalled payload and the codec used for it.
+// Payloads passed by reference are marshalled with the fallback codec.
+func (evt Event) marshalled() (Codec, []byte, error) {
+	if !evt.byReference {
+		return evt.Codec(), evt.payload, nil
+	}
+	fallback := evt.codec.(referenceCodec).fallback
+	data, err := fallback.Marshal(evt.value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot marshal payload: %v", err)
+	}
+	return fallback, data, nil
+}
+
+// payloadString returns the payload for the string representation.
+func (evt Event) payloadString() string {
+	switch {
+	case evt.byReference:
+		return fmt.Sprintf("%v", evt.value)
+	case evt.Codec().Name() == CodecJSON:
+		return string(evt.payload)
+	case evt.payload == nil:
+		return ""
+	}
+	return fmt.Sprintf("<%s:%x>", evt.Codec().Name(), evt.payload)
+}
+
+// initReplier makes the event a request.
+func (evt *Event) initReplier() <-chan *Event {
+	evt.replier = &replier{
+		replyc: make(chan *Event, 1),
+	}
+	return evt.replier.replyc
+}
+
+// initCause sets causation and, if not yet set, correlation and
+// span context based on the event which caused this one.
+func (evt *Event) initCause(cause *Event) {
+	if cause == nil || cause.id == evt.id || evt.causationID != "" {
+		return
+	}
+	evt.causationID = cause.id
+	if evt.correlationID == "" {
+		evt.correlationID = cause.correlationID
+	}
+	if !evt.spanContext.IsValid() {
+		evt.spanContext = cause.spanContext
+	}
+}
+
 // initEmitters sets the emitters to the mesh value.
 func (evt *Event) initEmitters() {
 	evt.emitters = []string{"/"}
 }
 
-// appendEmitter is used by the different emitters to signal their a
-// sender or passer of an event.
-func (evt *Event) appendEmitter(name string) {
-	evt.emitters = append(evt.emitters, name)
+// withEmitter is used by the different emitters to signal their a
+// sender or passer of an event. It returns a copy with the extended
+// emitters path, because re-emitted events are shared with the other
+// subscribers of the former emitter.
+func (evt *Event) withEmitter(name string) *Event {
+	emitted := *evt
+	emitted.emitters = make([]string, len(evt.emitters), len(evt.emitters)+1)
+	copy(emitted.emitters, evt.emitters)
+	emitted.emitters = append(emitted.emitters, name)
+	return &emitted
+}
+
+//--------------------
+// REPLIER
+//--------------------
+
+// replier is the reply address of a request.
+type replier struct {
+	mu      sync.Mutex
+	replied bool
+	replyc  chan *Event
+}
+
+// reply sends the reply to the waiting requester.
+func (r *replier) reply(evt *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replied {
+		return errors.New("request already replied")
+	}
+	r.replied = true
+	r.replyc <- evt
+	return nil
 }
 
 // EOF
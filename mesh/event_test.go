@@ -14,6 +14,7 @@ package mesh_test // import "tideland.dev/go/cells/mesh"
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"tideland.dev/go/audit/asserts"
 
@@ -74,6 +75,124 @@ func TestEventPayload(t *testing.T) {
 
 }
 
+// TestEventIDs verifies the event, correlation, and causation IDs.
+func TestEventIDs(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	evtA, err := mesh.NewEvent("test")
+	assert.NoError(err)
+	evtB, err := mesh.NewEvent("test")
+	assert.NoError(err)
+	assert.Length(evtA.ID(), 32)
+	assert.Different(evtA.ID(), evtB.ID())
+	assert.Equal(evtA.CorrelationID(), "")
+	assert.Equal(evtA.CausationID(), "")
+
+	evt, err := mesh.NewEvent("test", mesh.WithCorrelationID("order-1"), 1, 2)
+	assert.NoError(err)
+	assert.Equal(evt.CorrelationID(), "order-1")
+	payload := []int{}
+	err = evt.Payload(&payload)
+	assert.NoError(err)
+	assert.Equal(payload, []int{1, 2})
+
+	evt, err = mesh.NewEvent("test", mesh.WithCorrelationID("order-2"))
+	assert.NoError(err)
+	assert.False(evt.HasPayload())
+
+	data, err := json.Marshal(evt)
+	assert.NoError(err)
+	assert.Contains(`"correlationId":"order-2"`, string(data))
+	evtOut, err := mesh.NewEvent("empty")
+	assert.NoError(err)
+	err = json.Unmarshal(data, &evtOut)
+	assert.NoError(err)
+	assert.Equal(evtOut.ID(), evt.ID())
+	assert.Equal(evtOut.CorrelationID(), "order-2")
+}
+
+// TestEventHeaders verifies the metadata headers of events.
+func TestEventHeaders(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	evt, err := mesh.NewEvent("test")
+	assert.NoError(err)
+	_, ok := evt.Header("tenant")
+	assert.False(ok)
+	assert.Empty(evt.Headers())
+
+	evt, err = mesh.NewEvent("test",
+		mesh.WithHeader("tenant", "acme"),
+		mesh.WithHeaders(map[string]string{"source": "plant-1", "schema": "v2"}),
+		42,
+	)
+	assert.NoError(err)
+	tenant, ok := evt.Header("tenant")
+	assert.True(ok)
+	assert.Equal(tenant, "acme")
+	assert.Equal(evt.Headers(), map[string]string{"tenant": "acme", "source": "plant-1", "schema": "v2"})
+	assert.Contains("Headers:map[schema:v2 source:plant-1 tenant:acme]", evt.String())
+
+	// Returned headers are a copy.
+	headers := evt.Headers()
+	headers["tenant"] = "other"
+	tenant, _ = evt.Header("tenant")
+	assert.Equal(tenant, "acme")
+
+	data, err := json.Marshal(evt)
+	assert.NoError(err)
+	assert.Contains(`"headers":{"schema":"v2","source":"plant-1","tenant":"acme"}`, string(data))
+	evtOut, err := mesh.NewEvent("empty")
+	assert.NoError(err)
+	err = json.Unmarshal(data, &evtOut)
+	assert.NoError(err)
+	assert.Equal(evtOut.Headers(), evt.Headers())
+}
+
+// TestEventDerive verifies the deriving of events with new topics.
+func TestEventDerive(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	timestamp := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	evt, err := mesh.NewEvent("temp", 21.5,
+		mesh.WithHeader("unit", "celsius"),
+		mesh.WithCorrelationID("c-1"),
+		mesh.WithTimestamp(timestamp),
+	)
+	assert.NoError(err)
+	derived, err := evt.Derive("temperature")
+	assert.NoError(err)
+	assert.Equal(derived.Topic(), "temperature")
+	assert.Different(derived.ID(), evt.ID())
+	assert.Equal(derived.CorrelationID(), "c-1")
+	assert.Equal(derived.Timestamp(), timestamp)
+	assert.Equal(derived.Headers(), evt.Headers())
+	value, err := mesh.PayloadAs[float64](derived)
+	assert.NoError(err)
+	assert.Equal(value, 21.5)
+
+	_, err = evt.Derive("")
+	assert.ErrorContains(err, "event needs topic")
+}
+
+// TestEventWith verifies the changed copies of events.
+func TestEventWith(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	evt, err := mesh.NewEvent("temp", 21.5, mesh.WithHeader("unit", "celsius"))
+	assert.NoError(err)
+	changed := evt.With(mesh.WithHeader("unit", "kelvin"), mesh.WithCorrelationID("c-1"))
+	assert.Equal(changed.ID(), evt.ID())
+	assert.Equal(changed.Topic(), "temp")
+	assert.Equal(changed.CorrelationID(), "c-1")
+	assert.Equal(changed.Headers(), map[string]string{"unit": "kelvin"})
+	assert.Equal(evt.CorrelationID(), "")
+	assert.Equal(evt.Headers(), map[string]string{"unit": "celsius"})
+	value, err := mesh.PayloadAs[float64](changed)
+	assert.NoError(err)
+	assert.Equal(value, 21.5)
+}
+
 // TestEventMarshaling verifies the event marshaling and unmarshaling.
 func TestEventMarshaling(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
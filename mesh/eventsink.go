@@ -12,6 +12,7 @@ package mesh // import "tideland.dev/go/cells/mesh"
 //--------------------
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -296,4 +297,29 @@ func EventSinkDuration(r EventSinkReader) time.Duration {
 	return last.Timestamp().Sub(first.Timestamp())
 }
 
+// EventSinkSnapshot returns the events of the sink encoded as JSON,
+// e.g. for the snapshot of a behavior.
+func EventSinkSnapshot(r EventSinkReader) ([]byte, error) {
+	evts := make([]*Event, 0, r.Len())
+	r.Do(func(i int, evt *Event) error {
+		evts = append(evts, evt)
+		return nil
+	})
+	return json.Marshal(evts)
+}
+
+// EventSinkRestore replaces the events of the sink with the ones
+// encoded by EventSinkSnapshot().
+func EventSinkRestore(s EventSink, data []byte) error {
+	var evts []*Event
+	if err := json.Unmarshal(data, &evts); err != nil {
+		return err
+	}
+	s.Clear()
+	for _, evt := range evts {
+		s.Push(evt)
+	}
+	return nil
+}
+
 // EOF
@@ -189,6 +189,20 @@ func TestEventSinkFunctions(t *testing.T) {
 	assert.Equal(payload["b"], 6)
 }
 
+// TestEventSinkSnapshot verifies restoring a sink out of a snapshot.
+func TestEventSinkSnapshot(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	sink := mesh.NewEventSink(0, generateTopicEvents([]string{"a", "b", "c"})...)
+	data, err := mesh.EventSinkSnapshot(sink)
+	assert.NoError(err)
+
+	restored := mesh.NewEventSink(2, generateTopicEvents([]string{"x"})...)
+	assert.NoError(mesh.EventSinkRestore(restored, data))
+	assert.Equal(restored.String(), `["b" "c"]`)
+	assert.ErrorContains(mesh.EventSinkRestore(restored, []byte("{broken")), "invalid character")
+	assert.Length(restored, 2)
+}
+
 //--------------------
 // HELPER
 //--------------------
@@ -0,0 +1,55 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"time"
+)
+
+//--------------------
+// CELL INFO
+//--------------------
+
+// CellInfo contains information about a running cell as returned
+// by Mesh.CellInfo(). Parent is the name of the cell which started
+// this one via its mesh, otherwise it's empty. Delivered contains
+// the number of emitted events delivered to each subscriber.
+type CellInfo struct {
+	Name      string
+	Parent    string
+	Behavior  string
+	StartedAt time.Time
+	QueueLen  int
+	Processed uint64
+	Emitted   uint64
+	Delivered map[string]uint64
+	Active    bool
+}
+
+// String implements fmt.Stringer.
+func (ci CellInfo) String() string {
+	return fmt.Sprintf(
+		"CellInfo{Name:%s Parent:%s Behavior:%s StartedAt:%s QueueLen:%d Processed:%d Emitted:%d Delivered:%v Active:%v}",
+		ci.Name,
+		ci.Parent,
+		ci.Behavior,
+		ci.StartedAt.Format(time.RFC3339Nano),
+		ci.QueueLen,
+		ci.Processed,
+		ci.Emitted,
+		ci.Delivered,
+		ci.Active,
+	)
+}
+
+// EOF
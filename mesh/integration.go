@@ -0,0 +1,227 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//--------------------
+// INTEGRATION TESTBED
+//--------------------
+
+// capturePrefix is the prefix of the names of the capturing cells.
+const capturePrefix = "capture:"
+
+// integrationPause is the pause between the checks when waiting.
+const integrationPause = time.Millisecond
+
+// IntegrationTestbed provides a real mesh for the integration testing
+// of multiple cells. Contrary to the Testbed the behaviors can use
+// their mesh. Events can be emitted to any cell and the events emitted
+// by cells are captured in sinks, which can be checked by the waiting
+// assertions. Those return errors, so they can be used with any test
+// library.
+//
+//	itb := mesh.NewIntegrationTestbed()
+//	defer itb.Stop()
+//	itb.Go("input", broadcaster.New())
+//	itb.Go("alarms", filter.NewIncluding(isAlarm))
+//	itb.Subscribe("input", "alarms")
+//	itb.Capture("alarms")
+//	itb.Emit("input", "alarm.fire")
+//	evt, err := itb.WaitForTopic("alarms", "alarm.fire", time.Second)
+type IntegrationTestbed struct {
+	ctx    context.Context
+	cancel func()
+	msh    Mesh
+	mu     sync.RWMutex
+	sinks  map[string]EventSink
+}
+
+// NewIntegrationTestbed creates an integration testbed with an empty
+// mesh configured by the options.
+func NewIntegrationTestbed(options ...MeshOption) *IntegrationTestbed {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &IntegrationTestbed{
+		ctx:    ctx,
+		cancel: cancel,
+		msh:    New(ctx, options...),
+		sinks:  make(map[string]EventSink),
+	}
+}
+
+// Mesh returns the mesh of the testbed for all other operations.
+func (itb *IntegrationTestbed) Mesh() Mesh {
+	return itb.msh
+}
+
+// Go starts a cell in the mesh of the testbed.
+func (itb *IntegrationTestbed) Go(name string, b Behavior, options ...CellOption) error {
+	return itb.msh.Go(name, b, options...)
+}
+
+// Subscribe subscribes the receptor cell to the emitter cell for
+// events matching the optional topic patterns.
+func (itb *IntegrationTestbed) Subscribe(emitterName, receptorName string, patterns ...string) error {
+	return itb.msh.SubscribeTopics(emitterName, receptorName, patterns...)
+}
+
+// Emit creates an event and raises it to the named cell.
+func (itb *IntegrationTestbed) Emit(name, topic string, payloads ...interface{}) error {
+	return itb.msh.Emit(name, topic, payloads...)
+}
+
+// EmitEvent raises an event to the named cell.
+func (itb *IntegrationTestbed) EmitEvent(name string, evt *Event) error {
+	return itb.msh.EmitEvent(name, evt)
+}
+
+// Capture starts capturing the events emitted by the named cells.
+func (itb *IntegrationTestbed) Capture(names ...string) error {
+	itb.mu.Lock()
+	defer itb.mu.Unlock()
+	for _, name := range names {
+		if itb.sinks[name] != nil {
+			continue
+		}
+		sink := NewEventSink(0)
+		captureName := capturePrefix + name
+		captureFunc := func(cell Cell, in Receptor, out Emitter) error {
+			for {
+				select {
+				case <-cell.Context().Done():
+					return nil
+				case evt := <-in.Pull():
+					sink.Push(evt)
+				}
+			}
+		}
+		if err := itb.msh.Go(captureName, BehaviorFunc(captureFunc)); err != nil {
+			return err
+		}
+		if err := itb.msh.Subscribe(name, captureName); err != nil {
+			itb.msh.Stop(captureName)
+			return err
+		}
+		itb.sinks[name] = sink
+	}
+	return nil
+}
+
+// Captured returns the events captured for the named cell.
+func (itb *IntegrationTestbed) Captured(name string) (EventSinkReader, error) {
+	itb.mu.RLock()
+	defer itb.mu.RUnlock()
+	sink := itb.sinks[name]
+	if sink == nil {
+		return nil, fmt.Errorf("cell '%s' is not captured", name)
+	}
+	return sink, nil
+}
+
+// Topics returns the topics of the events captured for the named cell.
+func (itb *IntegrationTestbed) Topics(name string) ([]string, error) {
+	sink, err := itb.Captured(name)
+	if err != nil {
+		return nil, err
+	}
+	topics := []string{}
+	sink.Do(func(i int, evt *Event) error {
+		topics = append(topics, evt.Topic())
+		return nil
+	})
+	return topics, nil
+}
+
+// WaitForTopic waits until the named cell emitted an event with the
+// topic and returns it. It returns an error if this doesn't happen
+// within the timeout.
+func (itb *IntegrationTestbed) WaitForTopic(name, topic string, timeout time.Duration) (*Event, error) {
+	sink, err := itb.Captured(name)
+	if err != nil {
+		return nil, err
+	}
+	var found *Event
+	ok := itb.waitFor(timeout, func() (bool, bool) {
+		sink.Do(func(i int, evt *Event) error {
+			if found == nil && evt.Topic() == topic {
+				found = evt
+			}
+			return nil
+		})
+		return found != nil, false
+	})
+	if !ok {
+		return nil, fmt.Errorf("cell '%s' emitted no event with topic '%s' within %v", name, topic, timeout)
+	}
+	return found, nil
+}
+
+// WaitForTopics waits until the topics of the events emitted by the
+// named cell equal the given sequence. It returns an error as soon as
+// they differ or if the sequence is not complete within the timeout.
+func (itb *IntegrationTestbed) WaitForTopics(name string, topics []string, timeout time.Duration) error {
+	var current []string
+	ok := itb.waitFor(timeout, func() (bool, bool) {
+		var err error
+		current, err = itb.Topics(name)
+		if err != nil {
+			return false, true
+		}
+		if len(current) > len(topics) {
+			return false, true
+		}
+		for i := range current {
+			if current[i] != topics[i] {
+				return false, true
+			}
+		}
+		return len(current) == len(topics), false
+	})
+	if !ok {
+		if _, err := itb.Captured(name); err != nil {
+			return err
+		}
+		return fmt.Errorf("cell '%s' emitted topics %v instead of %v within %v", name, current, topics, timeout)
+	}
+	return nil
+}
+
+// Stop shuts the mesh of the testbed down.
+func (itb *IntegrationTestbed) Stop() error {
+	defer itb.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return itb.msh.Shutdown(ctx)
+}
+
+// waitFor checks the condition until it returns success, it gives up,
+// or the timeout is reached.
+func (itb *IntegrationTestbed) waitFor(timeout time.Duration, check func() (success, giveUp bool)) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		success, giveUp := check()
+		switch {
+		case success:
+			return true
+		case giveUp || !time.Now().Before(deadline):
+			return false
+		}
+		time.Sleep(integrationPause)
+	}
+}
+
+// EOF
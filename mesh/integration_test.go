@@ -0,0 +1,107 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestIntegrationTestbed verifies the testing of multiple cells
+// working together.
+func TestIntegrationTestbed(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	forwardFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	upperFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.Emit(strings.ToUpper(evt.Topic()))
+			}
+		}
+	}
+	itb := mesh.NewIntegrationTestbed()
+	defer itb.Stop()
+
+	assert.NoError(itb.Go("input", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Go("upper", mesh.BehaviorFunc(upperFunc)))
+	assert.NoError(itb.Go("alarms", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Subscribe("input", "upper"))
+	assert.NoError(itb.Subscribe("input", "alarms", "alarm.*"))
+	assert.NoError(itb.Capture("upper", "alarms"))
+	assert.ErrorContains(itb.Capture("dont-exist"), "emitter cell 'dont-exist' does not exist")
+	_, err := itb.Captured("input")
+	assert.ErrorContains(err, "cell 'input' is not captured")
+
+	assert.NoError(itb.Emit("input", "info"))
+	assert.NoError(itb.Emit("input", "alarm.fire"))
+	evt, err := mesh.NewEvent("alarm.water", 42)
+	assert.NoError(err)
+	assert.NoError(itb.EmitEvent("input", evt))
+
+	// Waiting for topics.
+	evt, err = itb.WaitForTopic("alarms", "alarm.water", time.Second)
+	assert.NoError(err)
+	assert.Equal(evt.Emitters(), "/input/alarms")
+	_, err = itb.WaitForTopic("alarms", "info", 50*time.Millisecond)
+	assert.ErrorContains(err, "cell 'alarms' emitted no event with topic 'info' within 50ms")
+	_, err = itb.WaitForTopic("input", "info", time.Second)
+	assert.ErrorContains(err, "cell 'input' is not captured")
+
+	// Waiting for sequences of topics.
+	assert.NoError(itb.WaitForTopics("upper", []string{"INFO", "ALARM.FIRE", "ALARM.WATER"}, time.Second))
+	assert.NoError(itb.WaitForTopics("alarms", []string{"alarm.fire", "alarm.water"}, time.Second))
+	err = itb.WaitForTopics("alarms", []string{"alarm.water", "alarm.fire"}, time.Second)
+	assert.ErrorContains(err, "cell 'alarms' emitted topics [alarm.fire alarm.water] instead of [alarm.water alarm.fire]")
+	err = itb.WaitForTopics("alarms", []string{"alarm.fire"}, time.Second)
+	assert.ErrorContains(err, "instead of [alarm.fire]")
+	err = itb.WaitForTopics("alarms", []string{"alarm.fire", "alarm.water", "alarm.air"}, 50*time.Millisecond)
+	assert.ErrorContains(err, "within 50ms")
+	err = itb.WaitForTopics("input", nil, time.Second)
+	assert.ErrorContains(err, "cell 'input' is not captured")
+
+	sink, err := itb.Captured("upper")
+	assert.NoError(err)
+	assert.Equal(sink.Len(), 3)
+
+	// Behaviors can use the mesh.
+	msh := itb.Mesh()
+	assert.NoError(msh.Go("late", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Subscribe("upper", "late"))
+	assert.NoError(itb.Capture("late"))
+	assert.NoError(itb.Emit("input", "late"))
+	assert.NoError(itb.WaitForTopics("late", []string{"LATE"}, time.Second))
+
+	assert.NoError(itb.Stop())
+}
+
+// EOF
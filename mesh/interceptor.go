@@ -0,0 +1,75 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// INTERCEPTION POINTS
+//--------------------
+
+// InterceptionPoint tells where an event is intercepted.
+type InterceptionPoint int
+
+// Interception points.
+const (
+	// InterceptReceive is the delivery of an event into the
+	// queue of a cell.
+	InterceptReceive InterceptionPoint = iota
+
+	// InterceptEmit is the emitting of an event by a cell to
+	// its subscribers.
+	InterceptEmit
+)
+
+// String implements fmt.Stringer.
+func (ip InterceptionPoint) String() string {
+	switch ip {
+	case InterceptReceive:
+		return "receive"
+	case InterceptEmit:
+		return "emit"
+	}
+	return "unknown"
+}
+
+//--------------------
+// INTERCEPTOR
+//--------------------
+
+// Interceptor is called with the name of the cell for each event it
+// receives or emits. It returns the event to continue with, which is
+// the passed one, a changed copy created with Event.With(), or a new
+// one. Passed events must not be changed, they may be shared with
+// other cells. Returning no event drops it silently, e.g. for sampling.
+// Returning an error rejects the event, the cell then emits an event
+// with the topic TopicError to its subscribers.
+//
+// Interceptors for received events are called in the goroutine of the
+// emitter or, for events of other cells, of the lane delivering them.
+// Those for emitted events are called in the one of the emitting cell.
+// So the order of the events per emitter is kept. Rejections of
+// received events are reported immediately, not in the order of the
+// events processed by the cell.
+type Interceptor func(cell string, point InterceptionPoint, evt *Event) (*Event, error)
+
+// interceptorChain calls interceptors in their order.
+type interceptorChain []Interceptor
+
+// intercept passes the event through the chain. It stops at the
+// first interceptor dropping or rejecting it.
+func (ic interceptorChain) intercept(cell string, point InterceptionPoint, evt *Event) (*Event, error) {
+	for _, interceptor := range ic {
+		var err error
+		evt, err = interceptor(cell, point, evt)
+		if err != nil || evt == nil {
+			return nil, err
+		}
+	}
+	return evt, nil
+}
+
+// EOF
@@ -0,0 +1,143 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestInterceptorOrder verifies the order of mesh and cell interceptors.
+func TestInterceptorOrder(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	var mu sync.Mutex
+	var calls []string
+	tracer := func(id string) mesh.Interceptor {
+		return func(cell string, point mesh.InterceptionPoint, evt *mesh.Event) (*mesh.Event, error) {
+			if !strings.HasPrefix(cell, "capture:") {
+				mu.Lock()
+				calls = append(calls, id+"/"+cell+"/"+point.String()+"/"+evt.Topic())
+				mu.Unlock()
+			}
+			return evt, nil
+		}
+	}
+	itb := mesh.NewIntegrationTestbed(mesh.WithInterceptors(tracer("m1"), tracer("m2")))
+	defer itb.Stop()
+	assert.NoError(itb.Go("forward", mesh.BehaviorFunc(forwardFunc), mesh.WithCellInterceptors(tracer("c1"))))
+	assert.NoError(itb.Capture("forward"))
+
+	assert.NoError(itb.Emit("forward", "a"))
+	assert.NoError(itb.WaitForTopics("forward", []string{"a"}, time.Second))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(calls, []string{
+		"m1/forward/receive/a",
+		"m2/forward/receive/a",
+		"c1/forward/receive/a",
+		"m1/forward/emit/a",
+		"m2/forward/emit/a",
+		"c1/forward/emit/a",
+	})
+}
+
+// TestInterceptorChanges verifies changing, dropping, and rejecting
+// events by interceptors.
+func TestInterceptorChanges(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	authorize := func(cell string, point mesh.InterceptionPoint, evt *mesh.Event) (*mesh.Event, error) {
+		if point == mesh.InterceptReceive && evt.Topic() == "forbidden" {
+			return nil, errors.New("not allowed")
+		}
+		return evt, nil
+	}
+	tag := func(cell string, point mesh.InterceptionPoint, evt *mesh.Event) (*mesh.Event, error) {
+		if point != mesh.InterceptEmit {
+			return evt, nil
+		}
+		switch evt.Topic() {
+		case "noise":
+			return nil, nil
+		case "secret":
+			return nil, errors.New("must not leave")
+		}
+		return evt.With(mesh.WithHeader("tagged-by", cell)), nil
+	}
+	itb := mesh.NewIntegrationTestbed(mesh.WithInterceptors(authorize))
+	defer itb.Stop()
+	assert.NoError(itb.Go("forward", mesh.BehaviorFunc(forwardFunc), mesh.WithCellInterceptors(tag)))
+	assert.NoError(itb.Capture("forward"))
+
+	// Rejections of received events are reported immediately.
+	assert.NoError(itb.Emit("forward", "forbidden"))
+	assert.NoError(itb.WaitForTopics("forward", []string{mesh.TopicError}, time.Second))
+	for _, topic := range []string{"a", "noise", "secret", "b"} {
+		assert.NoError(itb.Emit("forward", topic))
+	}
+	assert.NoError(itb.WaitForTopics("forward", []string{
+		mesh.TopicError, "a", mesh.TopicError, "b",
+	}, time.Second))
+
+	sink, err := itb.Captured("forward")
+	assert.NoError(err)
+	expected := []string{
+		"receive of event 'forbidden' rejected: not allowed",
+		"",
+		"emit of event 'secret' rejected: must not leave",
+		"",
+	}
+	sink.Do(func(i int, evt *mesh.Event) error {
+		if evt.Topic() != mesh.TopicError {
+			tagger, ok := evt.Header("tagged-by")
+			assert.True(ok)
+			assert.Equal(tagger, "forward")
+			return nil
+		}
+		payload, err := mesh.PayloadAs[mesh.PayloadCellError](evt)
+		assert.NoError(err)
+		assert.Equal(payload.CellName, "forward")
+		assert.Equal(payload.Error, expected[i])
+		return nil
+	})
+	info, err := itb.Mesh().CellInfo("forward")
+	assert.NoError(err)
+	assert.Equal(info.Processed, uint64(4))
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// forwardFunc is a behavior function emitting all received events.
+func forwardFunc(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			out.EmitEvent(evt)
+		}
+	}
+}
+
+// EOF
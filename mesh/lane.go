@@ -0,0 +1,126 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//--------------------
+// LANE
+//--------------------
+
+// lane delivers the events of an emitting cell to one subscriber in
+// the order they have been emitted. Each lane runs independently, so
+// a slow subscriber does not block the delivery to the others as long
+// as its queue has space. The events in a lane already hold their
+// slots in the queue of the subscriber, so its size and policy apply
+// like for events emitted via the mesh.
+type lane struct {
+	mu     sync.RWMutex
+	from   *cell
+	to     *cell
+	link   *cellLink
+	eventc chan *Event
+	donec  chan struct{}
+	once   sync.Once
+	closed bool
+}
+
+// newLane creates a lane between the cells and starts it. It buffers
+// as many events as the queue of the subscriber.
+func newLane(from, to *cell, link *cellLink) *lane {
+	l := &lane{
+		from:   from,
+		to:     to,
+		link:   link,
+		eventc: make(chan *Event, to.in.cfg.size),
+		donec:  make(chan struct{}),
+	}
+	go l.backend()
+	return l
+}
+
+// push appends an event to the lane after admitting it to the queue
+// of the subscriber. Events for deactivated subscribers become dead
+// letters immediately. If the queue is full its policy decides.
+// Rejected or timed out events become dead letters too and return a
+// QueueOverflowError. Events for a closed lane are discarded.
+func (l *lane) push(evt *Event) error {
+	if !l.to.active.Load().(bool) {
+		err := errCellDeactivated
+		l.from.deadLetter(evt, l.to.name, err)
+		return err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return nil
+	}
+	admitted, err := l.to.in.admit(evt, l.donec, l.dropOldest)
+	if !admitted {
+		if err != nil {
+			l.from.deadLetter(evt, l.to.name, err)
+		}
+		return err
+	}
+	atomic.AddInt64(&l.to.incoming, 1)
+	l.eventc <- evt
+	return nil
+}
+
+// dropOldest removes the oldest event out of the lane or, if it is
+// empty, out of the queue of the subscriber. It returns false if there
+// is none.
+func (l *lane) dropOldest() bool {
+	select {
+	case dropped := <-l.eventc:
+		str := l.to.in
+		str.release()
+		atomic.AddUint64(&str.overflowed, 1)
+		str.logger.Warn("event dropped", "topic", dropped.Topic(), "policy", str.cfg.policy)
+		atomic.AddInt64(&l.to.incoming, -1)
+		str.signal()
+		return true
+	default:
+		return l.to.in.dropOldest()
+	}
+}
+
+// close ends the lane after the already pushed events are delivered.
+// Emitters waiting for space in the lane are released first.
+func (l *lane) close() {
+	l.once.Do(func() {
+		close(l.donec)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.closed = true
+		close(l.eventc)
+	})
+}
+
+// backend runs as goroutine and passes the events to the subscriber.
+// Failed deliveries become dead letters.
+func (l *lane) backend() {
+	for evt := range l.eventc {
+		if err := l.to.acceptQueued(evt); err != nil {
+			l.from.deadLetter(evt, l.to.name, err)
+		} else {
+			atomic.AddUint64(&l.link.delivered, 1)
+		}
+		atomic.AddInt64(&l.to.incoming, -1)
+		l.to.in.signal()
+	}
+}
+
+// EOF
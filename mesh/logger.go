@@ -0,0 +1,220 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//--------------------
+// LOGGER
+//--------------------
+
+// Logger is a structured logger. Its methods are the same as those of
+// the *slog.Logger of the standard library, so it can be passed directly.
+// The args are alternating keys and values.
+type Logger interface {
+	// Debug logs a message at debug level.
+	Debug(msg string, args ...interface{})
+
+	// Info logs a message at info level.
+	Info(msg string, args ...interface{})
+
+	// Warn logs a message at warning level.
+	Warn(msg string, args ...interface{})
+
+	// Error logs a message at error level.
+	Error(msg string, args ...interface{})
+}
+
+// defaultLogger is used if no logger is set.
+var defaultLogger Logger = nopLogger{}
+
+// nopLogger discards all messages.
+type nopLogger struct{}
+
+// Debug implements Logger.
+func (l nopLogger) Debug(msg string, args ...interface{}) {}
+
+// Info implements Logger.
+func (l nopLogger) Info(msg string, args ...interface{}) {}
+
+// Warn implements Logger.
+func (l nopLogger) Warn(msg string, args ...interface{}) {}
+
+// Error implements Logger.
+func (l nopLogger) Error(msg string, args ...interface{}) {}
+
+//--------------------
+// TAGGED LOGGER
+//--------------------
+
+// taggedLogger adds its tags in front of the args of each message.
+type taggedLogger struct {
+	logger Logger
+	tags   []interface{}
+}
+
+// withTags returns a logger adding the tags to each message.
+func withTags(logger Logger, tags ...interface{}) Logger {
+	if _, ok := logger.(nopLogger); ok {
+		return logger
+	}
+	return &taggedLogger{
+		logger: logger,
+		tags:   tags,
+	}
+}
+
+// Debug implements Logger.
+func (l *taggedLogger) Debug(msg string, args ...interface{}) {
+	l.logger.Debug(msg, l.tagged(args)...)
+}
+
+// Info implements Logger.
+func (l *taggedLogger) Info(msg string, args ...interface{}) {
+	l.logger.Info(msg, l.tagged(args)...)
+}
+
+// Warn implements Logger.
+func (l *taggedLogger) Warn(msg string, args ...interface{}) {
+	l.logger.Warn(msg, l.tagged(args)...)
+}
+
+// Error implements Logger.
+func (l *taggedLogger) Error(msg string, args ...interface{}) {
+	l.logger.Error(msg, l.tagged(args)...)
+}
+
+// tagged returns the tags followed by the args.
+func (l *taggedLogger) tagged(args []interface{}) []interface{} {
+	tagged := make([]interface{}, 0, len(l.tags)+len(args))
+	tagged = append(tagged, l.tags...)
+	return append(tagged, args...)
+}
+
+//--------------------
+// TEXT LOGGER
+//--------------------
+
+// LogLevel defines the minimum level of messages written by the
+// text logger.
+type LogLevel int
+
+// Log levels.
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// String implements fmt.Stringer.
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// textLogger writes the messages as lines of key/value pairs.
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+// NewTextLogger creates a logger writing messages of the level and
+// above as lines of key/value pairs into the writer like the text
+// handler of log/slog, e.g.
+//
+//	time=2021-06-01T12:00:00Z level=INFO msg="cell started" cell=foo
+func NewTextLogger(w io.Writer, level LogLevel) Logger {
+	return &textLogger{
+		w:     w,
+		level: level,
+	}
+}
+
+// Debug implements Logger.
+func (l *textLogger) Debug(msg string, args ...interface{}) {
+	l.log(LogDebug, msg, args)
+}
+
+// Info implements Logger.
+func (l *textLogger) Info(msg string, args ...interface{}) {
+	l.log(LogInfo, msg, args)
+}
+
+// Warn implements Logger.
+func (l *textLogger) Warn(msg string, args ...interface{}) {
+	l.log(LogWarn, msg, args)
+}
+
+// Error implements Logger.
+func (l *textLogger) Error(msg string, args ...interface{}) {
+	l.log(LogError, msg, args)
+}
+
+// log writes one message if its level is high enough.
+func (l *textLogger) log(level LogLevel, msg string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("time=")
+	sb.WriteString(time.Now().UTC().Format(time.RFC3339Nano))
+	sb.WriteString(" level=")
+	sb.WriteString(level.String())
+	sb.WriteString(" msg=")
+	sb.WriteString(logValue(msg))
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			// Value without key.
+			sb.WriteString(" !BADKEY=")
+			sb.WriteString(logValue(fmt.Sprintf("%v", args[i])))
+			i--
+			continue
+		}
+		sb.WriteString(" ")
+		sb.WriteString(key)
+		sb.WriteString("=")
+		sb.WriteString(logValue(fmt.Sprintf("%v", args[i+1])))
+	}
+	sb.WriteString("\n")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, sb.String())
+}
+
+// logValue quotes the value if needed.
+func logValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\n\t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// EOF
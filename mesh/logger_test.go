@@ -0,0 +1,137 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTextLogger verifies the format and the levels of the text logger.
+func TestTextLogger(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	var buf bytes.Buffer
+	logger := mesh.NewTextLogger(&buf, mesh.LogInfo)
+
+	logger.Debug("hidden")
+	logger.Info("cell started", "cell", "foo", "count", 42)
+	logger.Warn("quoted", "text", `a "b" c`, "empty", "")
+	logger.Error("odd", "key")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Length(lines, 3)
+	assert.True(strings.HasPrefix(lines[0], "time="))
+	assert.True(strings.HasSuffix(lines[0], ` level=INFO msg="cell started" cell=foo count=42`))
+	assert.True(strings.HasSuffix(lines[1], ` level=WARN msg=quoted text="a \"b\" c" empty=""`))
+	assert.True(strings.HasSuffix(lines[2], ` level=ERROR msg=odd !BADKEY=key`))
+}
+
+// TestCellLogging verifies the logging of the cells.
+func TestCellLogging(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buf := &logBuffer{}
+	releasec := make(chan struct{})
+	waitFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				cell.Logger().Debug("processing", "topic", evt.Topic())
+				switch evt.Topic() {
+				case "wait":
+					<-releasec
+				case "fail":
+					return errors.New("ouch")
+				}
+			}
+		}
+	}
+	msh := mesh.New(ctx, mesh.WithLogger(mesh.NewTextLogger(buf, mesh.LogDebug)))
+	assert.NoError(msh.Go("forward", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Go("wait", mesh.BehaviorFunc(waitFunc), mesh.WithQueue(1, mesh.QueueDropNewest)))
+	assert.NoError(msh.SubscribeTopics("forward", "wait", "w*"))
+	assert.NoError(msh.Unsubscribe("forward", "wait"))
+
+	// Dropped event.
+	assert.NoError(msh.Emit("wait", "wait"))
+	assert.Retry(func() bool {
+		return buf.contains(`msg=processing cell=wait`)
+	}, 100, 10*time.Millisecond)
+	assert.NoError(msh.Emit("wait", "a"))
+	assert.NoError(msh.Emit("wait", "b"))
+	close(releasec)
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("wait")
+		return err == nil && info.Processed == 2 && info.QueueLen == 0
+	}, 100, 10*time.Millisecond)
+
+	// Failing behavior.
+	assert.NoError(msh.Emit("wait", "fail"))
+	assert.Retry(func() bool {
+		return buf.contains(`msg="cell terminated" cell=wait`)
+	}, 100, 10*time.Millisecond)
+	assert.NoError(msh.Shutdown(ctx))
+
+	for _, expected := range []string{
+		`level=INFO msg="cell started" cell=forward behavior=mesh.BehaviorFunc`,
+		`level=INFO msg="cell subscribed" cell=wait behavior=mesh.BehaviorFunc emitter=forward patterns=[w*]`,
+		`level=INFO msg="cell unsubscribed" cell=wait behavior=mesh.BehaviorFunc emitter=forward`,
+		`level=DEBUG msg=processing cell=wait behavior=mesh.BehaviorFunc topic=wait`,
+		`level=WARN msg="event dropped" cell=wait behavior=mesh.BehaviorFunc topic=b policy=drop-newest`,
+		`level=ERROR msg="behavior failed" cell=wait behavior=mesh.BehaviorFunc error=ouch`,
+		`level=INFO msg="cell terminated" cell=wait`,
+		`level=INFO msg="cell terminated" cell=forward`,
+	} {
+		assert.True(buf.contains(expected), expected)
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// logBuffer collects the log output concurrently.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (lb *logBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.Write(p)
+}
+
+// contains checks if the log contains the text.
+func (lb *logBuffer) contains(text string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return strings.Contains(lb.buf.String(), text)
+}
+
+// EOF
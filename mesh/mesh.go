@@ -14,9 +14,41 @@ package mesh // import "tideland.dev/go/cells/mesh"
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+//--------------------
+// ERRORS
+//--------------------
+
+// ShutdownError collects the errors of the cells returned during
+// the shutdown of a mesh.
+type ShutdownError struct {
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (e *ShutdownError) Error() string {
+	return "shutdown errors: " + formatCellErrors(e.Errors)
+}
+
+// formatCellErrors joins the errors of cells sorted by their names.
+func formatCellErrors(errs map[string]error) string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("cell '%s': %v", name, errs[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
 //--------------------
 // MESH
 //--------------------
@@ -24,41 +56,74 @@ import (
 // mesh manages a closed network of cells. It implements
 // the Mesh interface.
 type mesh struct {
-	mu       sync.RWMutex
-	ctx      context.Context
-	cells    map[string]*cell
-	emitters map[string]*emitter
+	mu              sync.RWMutex
+	ctx             context.Context
+	cfg             *meshConfig
+	cells           map[string]*cell
+	emitters        map[string]*emitter
+	cancelSnapshots func()
 }
 
 // New creates new Mesh instance.
-func New(ctx context.Context) Mesh {
+func New(ctx context.Context, options ...MeshOption) Mesh {
 	m := &mesh{
 		ctx:      ctx,
+		cfg:      newMeshConfig(options...),
 		cells:    make(map[string]*cell),
 		emitters: make(map[string]*emitter),
 	}
+	if m.cfg.snapshots.store != nil && m.cfg.snapshots.interval > 0 {
+		sctx, cancel := context.WithCancel(ctx)
+		m.cancelSnapshots = cancel
+		go m.snapshotLoop(sctx)
+	}
 	return m
 }
 
 // Go implements Mesh.
-func (m *mesh) Go(name string, b Behavior) error {
+func (m *mesh) Go(name string, b Behavior, options ...CellOption) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.cells[name] != nil {
 		return fmt.Errorf("cell name '%s' already used", name)
 	}
+	options = append([]CellOption{
+		withCodec(m.cfg.codec),
+		withClock(m.cfg.clock),
+		WithCellInterceptors(m.cfg.interceptors...),
+		withTracer(m.cfg.tracer),
+		withLogger(m.cfg.logger),
+		withDeadLetters(m.deadLetter),
+	}, options...)
+	cfg := newCellConfig(options...)
+	if cfg.parent != nil && !cfg.parent.active.Load().(bool) {
+		return fmt.Errorf("parent cell '%s' is not active", cfg.parent.name)
+	}
+	if m.cfg.snapshots.store != nil {
+		if err := m.restoreBehavior(name, b); err != nil {
+			return err
+		}
+	}
 	m.cells[name] = newCell(m.ctx, name, m, b, func() {
 		// Callback for cell to unregister.
 		m.mu.Lock()
 		defer m.mu.Unlock()
 		delete(m.cells, name)
 		delete(m.emitters, name)
-	})
+	}, options...)
 	return nil
 }
 
 // Subscribe implements Mesh.
 func (m *mesh) Subscribe(emitterName, receptorName string) error {
+	return m.SubscribeTopics(emitterName, receptorName)
+}
+
+// SubscribeTopics implements Mesh.
+func (m *mesh) SubscribeTopics(emitterName, receptorName string, patterns ...string) error {
+	if err := ValidateTopicPatterns(patterns); err != nil {
+		return err
+	}
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	emitterCell := m.cells[emitterName]
@@ -69,7 +134,7 @@ func (m *mesh) Subscribe(emitterName, receptorName string) error {
 	if receptorCell == nil {
 		return fmt.Errorf("receptor cell '%s' does not exist", receptorName)
 	}
-	receptorCell.subscribeTo(emitterCell)
+	receptorCell.subscribeTo(emitterCell, patterns...)
 	return nil
 }
 
@@ -89,9 +154,88 @@ func (m *mesh) Unsubscribe(emitterName, receptorName string) error {
 	return nil
 }
 
+// Stop implements Mesh.
+func (m *mesh) Stop(name string) error {
+	m.mu.RLock()
+	stopCell := m.cells[name]
+	m.mu.RUnlock()
+	if stopCell == nil {
+		return fmt.Errorf("cell '%s' does not exist", name)
+	}
+	return stopCell.stopWithTimeout()
+}
+
+// Shutdown implements Mesh.
+func (m *mesh) Shutdown(ctx context.Context) error {
+	if m.cancelSnapshots != nil {
+		m.cancelSnapshots()
+	}
+	errs := make(map[string]error)
+	stopCells := m.stopOrder()
+	for _, stopCell := range stopCells {
+		if err := stopCell.stop(ctx); err != nil {
+			errs[stopCell.name] = err
+		}
+	}
+	if m.cfg.snapshots.store != nil {
+		// Take the snapshots after all events are processed.
+		for _, stopCell := range stopCells {
+			if err := m.snapshotCell(stopCell); err != nil && errs[stopCell.name] == nil {
+				errs[stopCell.name] = err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &ShutdownError{
+			Errors: errs,
+		}
+	}
+	return nil
+}
+
+// stopOrder returns the cells sorted topologically by their
+// subscriptions, emitters before subscribers. Cycles are broken
+// by taking the first remaining cell by name.
+func (m *mesh) stopOrder() []*cell {
+	m.mu.RLock()
+	remaining := make(map[string]*cell, len(m.cells))
+	for name, c := range m.cells {
+		remaining[name] = c
+	}
+	m.mu.RUnlock()
+	var order []*cell
+	for len(remaining) > 0 {
+		var names []string
+		var ready []string
+		for name, c := range remaining {
+			names = append(names, name)
+			free := true
+			c.input.do(func(ic *cell) error {
+				if ic != c && remaining[ic.name] == ic {
+					free = false
+				}
+				return nil
+			})
+			if free {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			sort.Strings(names)
+			ready = names[:1]
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			order = append(order, remaining[name])
+			delete(remaining, name)
+		}
+	}
+	return order
+}
+
 // Emit implements Mesh.
 func (m *mesh) Emit(name, topic string, payloads ...interface{}) error {
-	evt, err := NewEvent(topic, payloads...)
+	evt, err := m.newEvent(topic, payloads...)
 	if err != nil {
 		return err
 	}
@@ -107,7 +251,47 @@ func (m *mesh) EmitEvent(name string, evt *Event) error {
 		return fmt.Errorf("cell '%s' does not exist", name)
 	}
 	evt.initEmitters()
-	return emitCell.receiveEvent(evt)
+	return m.emitTo(emitCell, "/", evt)
+}
+
+// emitTo passes an event emitted by the named emitter directly to
+// the given cell.
+func (m *mesh) emitTo(emitCell *cell, emitter string, evt *Event) error {
+	if m.cfg.tracer == nil {
+		return emitCell.receiveEvent(evt)
+	}
+	evt, span := startSpan(m.cfg.tracer, SpanEmit, emitter, evt)
+	defer span.End()
+	if err := emitCell.receiveEvent(evt); err != nil {
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+// Request implements Mesh.
+func (m *mesh) Request(ctx context.Context, name, topic string, payloads ...interface{}) (*Event, error) {
+	evt, err := m.newEvent(topic, payloads...)
+	if err != nil {
+		return nil, err
+	}
+	replyc := evt.initReplier()
+	if err := m.EmitEvent(name, evt); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("request to cell '%s' not replied: %v", name, ctx.Err())
+	case reply := <-replyc:
+		return reply, nil
+	}
+}
+
+// newEvent creates an event using the default codec and the clock
+// of the mesh.
+func (m *mesh) newEvent(topic string, payloads ...interface{}) (*Event, error) {
+	payloads = append([]interface{}{WithCodec(m.cfg.codec), WithTimestamp(m.cfg.clock.Now())}, payloads...)
+	return NewEvent(topic, payloads...)
 }
 
 // Emitter implements Mesh.
@@ -128,4 +312,104 @@ func (m *mesh) Emitter(name string) (Emitter, error) {
 	return namedEmitter, nil
 }
 
+// Cells implements Mesh.
+func (m *mesh) Cells() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.cells))
+	for name := range m.cells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CellInfo implements Mesh.
+func (m *mesh) CellInfo(name string) (CellInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infoCell := m.cells[name]
+	if infoCell == nil {
+		return CellInfo{}, fmt.Errorf("cell '%s' does not exist", name)
+	}
+	return infoCell.info(), nil
+}
+
+// Subscribers implements Mesh.
+func (m *mesh) Subscribers(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	emitterCell := m.cells[name]
+	if emitterCell == nil {
+		return nil, fmt.Errorf("cell '%s' does not exist", name)
+	}
+	return emitterCell.output.names(), nil
+}
+
+// Subscriptions implements Mesh.
+func (m *mesh) Subscriptions(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	receptorCell := m.cells[name]
+	if receptorCell == nil {
+		return nil, fmt.Errorf("cell '%s' does not exist", name)
+	}
+	return receptorCell.input.names(), nil
+}
+
+// SubscriptionTopics implements Mesh.
+func (m *mesh) SubscriptionTopics(emitterName, receptorName string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	emitterCell := m.cells[emitterName]
+	receptorCell := m.cells[receptorName]
+	if emitterCell == nil {
+		return nil, fmt.Errorf("emitter cell '%s' does not exist", emitterName)
+	}
+	if receptorCell == nil {
+		return nil, fmt.Errorf("receptor cell '%s' does not exist", receptorName)
+	}
+	patterns, ok := emitterCell.output.patterns(receptorCell)
+	if !ok {
+		return nil, fmt.Errorf("cell '%s' is not subscribed to cell '%s'", receptorName, emitterName)
+	}
+	return patterns, nil
+}
+
+//--------------------
+// CELL MESH
+//--------------------
+
+// cellMesh is the mesh as seen by the behavior of a cell. Cells
+// started with it become children of that cell and are stopped
+// together with it.
+type cellMesh struct {
+	*mesh
+
+	parent *cell
+}
+
+// Go implements Mesh.
+func (cm *cellMesh) Go(name string, b Behavior, options ...CellOption) error {
+	return cm.mesh.Go(name, b, append(options, withParent(cm.parent))...)
+}
+
+// EmitEvent implements Mesh. The event is emitted directly to the
+// named cell on behalf of the cell owning the mesh. So instead of
+// resetting the emitters path it is extended by that cell, and the
+// currently processed event of it becomes the cause.
+func (cm *cellMesh) EmitEvent(name string, evt *Event) error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	emitCell := cm.cells[name]
+	if emitCell == nil {
+		return fmt.Errorf("cell '%s' does not exist", name)
+	}
+	// Copy the event, it may be shared with other cells.
+	evt = evt.withEmitter(cm.parent.name)
+	evt.initCause(cm.parent.in.current())
+	atomic.AddUint64(&cm.parent.emitted, 1)
+	return cm.emitTo(emitCell, cm.parent.name, evt)
+}
+
 // EOF
@@ -13,6 +13,8 @@ package mesh_test // import "tideland.dev/go/cells/mesh"
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -135,6 +137,68 @@ func TestMeshSubscriptions(t *testing.T) {
 	cancel()
 }
 
+// TestMeshSubscribeTopics verifies the subscription to events
+// with matching topics.
+func TestMeshSubscribeTopics(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	forwardFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	collectFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("forwarder", mesh.BehaviorFunc(forwardFunc))
+	msh.Go("collector", mesh.BehaviorFunc(collectFunc))
+
+	err := msh.SubscribeTopics("forwarder", "collector", "sensor.[a-.temp")
+	assert.ErrorContains(err, "invalid topic pattern")
+	_, err = msh.SubscriptionTopics("forwarder", "collector")
+	assert.ErrorContains(err, "cell 'collector' is not subscribed to cell 'forwarder'")
+
+	err = msh.SubscribeTopics("forwarder", "collector", "sensor.*.temp", "done")
+	assert.NoError(err)
+	patterns, err := msh.SubscriptionTopics("forwarder", "collector")
+	assert.NoError(err)
+	assert.Equal(patterns, []string{"sensor.*.temp", "done"})
+
+	msh.Emit("forwarder", "sensor.kitchen.humidity")
+	msh.Emit("forwarder", "sensor.kitchen.temp")
+	msh.Emit("forwarder", "other")
+	msh.Emit("forwarder", "done")
+
+	assert.Wait(sigc, "sensor.kitchen.temp", time.Second)
+	assert.Wait(sigc, "done", time.Second)
+
+	// Subscribing again without topics receives all.
+	err = msh.Subscribe("forwarder", "collector")
+	assert.NoError(err)
+	patterns, err = msh.SubscriptionTopics("forwarder", "collector")
+	assert.NoError(err)
+	assert.Length(patterns, 0)
+
+	msh.Emit("forwarder", "other")
+	assert.Wait(sigc, "other", time.Second)
+
+	cancel()
+}
+
 // TestMeshEmit verifies the emitting of events to one cell.
 func TestMeshEmit(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -172,6 +236,67 @@ func TestMeshEmit(t *testing.T) {
 	cancel()
 }
 
+// TestMeshRequest verifies the request of a cell and its reply.
+func TestMeshRequest(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	behaviorFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if !evt.IsRequest() {
+					continue
+				}
+				switch evt.Topic() {
+				case "ping":
+					var n int
+					if err := evt.Payload(&n); err != nil {
+						return err
+					}
+					if err := evt.Reply("pong", n+1); err != nil {
+						return err
+					}
+					if err := evt.Reply("pong", n+2); err == nil {
+						return errors.New("second reply possible")
+					}
+				}
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("responder", mesh.BehaviorFunc(behaviorFunc))
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	reply, err := msh.Request(rctx, "responder", "ping", 41)
+	rcancel()
+	assert.NoError(err)
+	assert.Equal(reply.Topic(), "pong")
+	var n int
+	assert.NoError(reply.Payload(&n))
+	assert.Equal(n, 42)
+
+	// No reply.
+	rctx, rcancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	reply, err = msh.Request(rctx, "responder", "dont-reply")
+	rcancel()
+	assert.Nil(reply)
+	assert.ErrorContains(err, "request to cell 'responder' not replied")
+
+	// Not existing cell.
+	_, err = msh.Request(ctx, "dont-exist", "ping", 1)
+	assert.ErrorContains(err, "cell 'dont-exist' does not exist")
+
+	// Events emitted without request cannot be replied.
+	evt, err := mesh.NewEvent("ping")
+	assert.NoError(err)
+	assert.False(evt.IsRequest())
+	assert.ErrorContains(evt.Reply("pong"), "event is no request")
+
+	cancel()
+}
+
 // TestMeshEmitter verifies the emitting of events to one cell using an emitter.
 func TestMeshEmitter(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -234,8 +359,443 @@ func TestMeshStoppedCell(t *testing.T) {
 	assert.NoError(msh.Emit("countdown", "one"))
 	assert.NoError(msh.Emit("countdown", "two"))
 	assert.NoError(msh.Emit("countdown", "three"))
-	assert.ErrorContains(msh.Emit("countdown", "four"), "timeout")
-	assert.ErrorContains(msh.Emit("countdown", "five"), "cell 'countdown' does not exist")
+	assert.Retry(func() bool {
+		err := msh.Emit("countdown", "four")
+		return err != nil && strings.Contains(err.Error(), "cell 'countdown' does not exist")
+	}, 10, 10*time.Millisecond)
+
+	cancel()
+}
+
+// TestMeshRestart verifies the supervised restarting of cells
+// keeping their subscriptions.
+func TestMeshRestart(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	failerFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if evt.Topic() == "fail" {
+					return errors.New("failing")
+				}
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	collectorFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("failer", mesh.BehaviorFunc(failerFunc), mesh.WithRestartPolicy(mesh.RestartPolicy{
+		Strategy:    mesh.RestartOnError,
+		MaxRestarts: 2,
+		Window:      time.Minute,
+		Backoff:     time.Millisecond,
+	}))
+	msh.Go("collector", mesh.BehaviorFunc(collectorFunc))
+	msh.Subscribe("failer", "collector")
+
+	assert.NoError(msh.Emit("failer", "fail"))
+	assert.Wait(sigc, mesh.TopicError, time.Second)
+	assert.Wait(sigc, mesh.TopicRestarted, time.Second)
+
+	assert.NoError(msh.Emit("failer", "hello"))
+	assert.Wait(sigc, "hello", time.Second)
+
+	assert.NoError(msh.Emit("failer", "fail"))
+	assert.Wait(sigc, mesh.TopicError, time.Second)
+	assert.Wait(sigc, mesh.TopicRestarted, time.Second)
+
+	assert.NoError(msh.Emit("failer", "fail"))
+	assert.Wait(sigc, mesh.TopicError, time.Second)
+	assert.Wait(sigc, mesh.TopicGivenUp, time.Second)
+
+	cancel()
+}
+
+// TestMeshQueue verifies the configuration of the input queue
+// of a cell.
+func TestMeshQueue(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	releasec := make(chan struct{})
+	blockerFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		<-releasec
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("blocker", mesh.BehaviorFunc(blockerFunc), mesh.WithQueue(2, mesh.QueueFailFast))
+
+	assert.NoError(msh.Emit("blocker", "one"))
+	assert.NoError(msh.Emit("blocker", "two"))
+	err := msh.Emit("blocker", "three")
+	var qoerr *mesh.QueueOverflowError
+	assert.True(errors.As(err, &qoerr))
+	assert.Equal(qoerr.CellName, "blocker")
+
+	close(releasec)
+	assert.Wait(sigc, "one", time.Second)
+	assert.Wait(sigc, "two", time.Second)
+
+	cancel()
+}
+
+// TestMeshIntrospection verifies the retrieval of information
+// about cells and their subscriptions.
+func TestMeshIntrospection(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	forwardFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	collectFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	assert.Length(msh.Cells(), 0)
+
+	msh.Go("c", mesh.BehaviorFunc(collectFunc))
+	msh.Go("b", mesh.BehaviorFunc(forwardFunc))
+	msh.Go("a", mesh.BehaviorFunc(forwardFunc))
+	msh.Subscribe("a", "b")
+	msh.Subscribe("b", "c")
+
+	assert.Equal(msh.Cells(), []string{"a", "b", "c"})
+
+	subscribers, err := msh.Subscribers("a")
+	assert.NoError(err)
+	assert.Equal(subscribers, []string{"b"})
+	subscriptions, err := msh.Subscriptions("c")
+	assert.NoError(err)
+	assert.Equal(subscriptions, []string{"b"})
+	subscriptions, err = msh.Subscriptions("a")
+	assert.NoError(err)
+	assert.Length(subscriptions, 0)
+
+	_, err = msh.Subscribers("dont-exist")
+	assert.ErrorContains(err, "cell 'dont-exist' does not exist")
+	_, err = msh.Subscriptions("dont-exist")
+	assert.ErrorContains(err, "cell 'dont-exist' does not exist")
+	_, err = msh.CellInfo("dont-exist")
+	assert.ErrorContains(err, "cell 'dont-exist' does not exist")
+
+	msh.Emit("a", "one")
+	msh.Emit("a", "two")
+	msh.Emit("a", "three")
+
+	assert.Wait(sigc, "one", time.Second)
+	assert.Wait(sigc, "two", time.Second)
+	assert.Wait(sigc, "three", time.Second)
+
+	info, err := msh.CellInfo("b")
+	assert.NoError(err)
+	assert.Equal(info.Name, "b")
+	assert.Equal(info.Behavior, "mesh.BehaviorFunc")
+	assert.Equal(info.Processed, uint64(3))
+	assert.Equal(info.Emitted, uint64(3))
+	assert.Equal(info.Delivered, map[string]uint64{"c": 3})
+	assert.Equal(info.QueueLen, 0)
+	assert.True(info.Active)
+	assert.False(info.StartedAt.IsZero())
+
+	cancel()
+}
+
+// TestMeshStop verifies the stopping of individual cells.
+func TestMeshStop(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	forwardFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	collectFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return errors.New("stopped")
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("forwarder", mesh.BehaviorFunc(forwardFunc))
+	msh.Go("collector", mesh.BehaviorFunc(collectFunc))
+	msh.Subscribe("forwarder", "collector")
+
+	assert.ErrorContains(msh.Stop("dont-exist"), "cell 'dont-exist' does not exist")
+
+	// Stopping the emitter informs the subscriber.
+	assert.NoError(msh.Emit("forwarder", "one"))
+	assert.NoError(msh.Stop("forwarder"))
+	assert.Wait(sigc, "one", time.Second)
+	assert.Wait(sigc, mesh.TopicTerminated, time.Second)
+	assert.Equal(msh.Cells(), []string{"collector"})
+	subscriptions, err := msh.Subscriptions("collector")
+	assert.NoError(err)
+	assert.Length(subscriptions, 0)
+	assert.ErrorContains(msh.Emit("forwarder", "two"), "cell 'forwarder' does not exist")
+
+	// Error of the behavior is returned.
+	assert.ErrorContains(msh.Stop("collector"), "stopped")
+	assert.Length(msh.Cells(), 0)
+
+	cancel()
+}
+
+// TestMeshStopTimeout verifies that stopping cells whose behaviors
+// ignore their context doesn't hang.
+func TestMeshStopTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	releasec := make(chan struct{})
+	defer close(releasec)
+	stuckFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		<-in.Pull()
+		<-releasec
+		return nil
+	}
+	parentFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		if err := cell.Mesh().Go("child", mesh.BehaviorFunc(stuckFunc)); err != nil {
+			return err
+		}
+		<-cell.Context().Done()
+		return nil
+	}
+	msh := mesh.New(ctx)
+
+	// Cell never returns.
+	assert.NoError(msh.Go("stuck", mesh.BehaviorFunc(stuckFunc), mesh.WithStopTimeout(50*time.Millisecond)))
+	assert.NoError(msh.Emit("stuck", "a"))
+	assert.NoError(msh.Emit("stuck", "b"))
+	start := time.Now()
+	assert.ErrorContains(msh.Stop("stuck"), "cell 'stuck' not drained")
+	assert.True(time.Since(start) < time.Second)
+
+	// Parent passes its stop context to the stuck child.
+	assert.NoError(msh.Go("parent", mesh.BehaviorFunc(parentFunc), mesh.WithStopTimeout(50*time.Millisecond)))
+	assert.Retry(func() bool {
+		_, err := msh.CellInfo("child")
+		return err == nil
+	}, 100, 10*time.Millisecond)
+	assert.NoError(msh.Emit("child", "a"))
+	start = time.Now()
+	msh.Stop("parent")
+	assert.True(time.Since(start) < time.Second)
+	info, err := msh.CellInfo("child")
+	assert.NoError(err)
+	assert.False(info.Active)
+}
+
+// TestMeshShutdown verifies the draining shutdown of all cells.
+func TestMeshShutdown(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	slowFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				time.Sleep(time.Millisecond)
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	countFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return errors.New("counted")
+			case evt := <-in.Pull():
+				if evt.Topic() == "count" {
+					count++
+				}
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("counter", mesh.BehaviorFunc(countFunc))
+	msh.Go("slow-b", mesh.BehaviorFunc(slowFunc))
+	msh.Go("slow-a", mesh.BehaviorFunc(slowFunc))
+	msh.Subscribe("slow-a", "slow-b")
+	msh.Subscribe("slow-b", "counter")
+
+	for i := 0; i < 25; i++ {
+		assert.NoError(msh.Emit("slow-a", "count"))
+	}
+
+	sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err := msh.Shutdown(sctx)
+	scancel()
+	var serr *mesh.ShutdownError
+	assert.True(errors.As(err, &serr))
+	assert.Length(serr.Errors, 1)
+	assert.ErrorContains(serr.Errors["counter"], "counted")
+	assert.Equal(count, 25)
+	assert.Length(msh.Cells(), 0)
+
+	cancel()
+}
+
+// TestMeshChildren verifies the starting of child cells by
+// a behavior.
+func TestMeshChildren(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	workerFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				out.Emit(cell.Name() + ":" + evt.Topic())
+			}
+		}
+	}
+	dispatcherFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				msh := cell.Mesh()
+				name := "worker-" + evt.Topic()
+				if _, err := msh.CellInfo(name); err != nil {
+					if err := msh.Go(name, mesh.BehaviorFunc(workerFunc)); err != nil {
+						return err
+					}
+					if err := msh.Subscribe(name, "collector"); err != nil {
+						return err
+					}
+				}
+				if err := msh.EmitEvent(name, evt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	collectorFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				sigc <- evt.Topic()
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("dispatcher", mesh.BehaviorFunc(dispatcherFunc))
+	msh.Go("collector", mesh.BehaviorFunc(collectorFunc))
+
+	msh.Emit("dispatcher", "a")
+	assert.Wait(sigc, "worker-a:a", time.Second)
+	msh.Emit("dispatcher", "b")
+	assert.Wait(sigc, "worker-b:b", time.Second)
+	msh.Emit("dispatcher", "a")
+	assert.Wait(sigc, "worker-a:a", time.Second)
+
+	assert.Equal(msh.Cells(), []string{"collector", "dispatcher", "worker-a", "worker-b"})
+	info, err := msh.CellInfo("worker-a")
+	assert.NoError(err)
+	assert.Equal(info.Parent, "dispatcher")
+	info, err = msh.CellInfo("dispatcher")
+	assert.NoError(err)
+	assert.Equal(info.Parent, "")
+
+	// Stopping the parent stops the children.
+	assert.NoError(msh.Stop("dispatcher"))
+	assert.Equal(msh.Cells(), []string{"collector"})
+
+	cancel()
+}
+
+// TestMeshCausation verifies the setting of causation and correlation
+// IDs when behaviors emit events while processing others.
+func TestMeshCausation(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := asserts.MakeWaitChan()
+	stepFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if cell.Name() == "last" {
+					var causeID string
+					if err := evt.Payload(&causeID); err != nil {
+						return err
+					}
+					sigc <- []bool{
+						evt.CausationID() == causeID,
+						evt.CorrelationID() == "trace",
+					}
+					continue
+				}
+				if err := out.Emit("step", evt.ID()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	msh.Go("first", mesh.BehaviorFunc(stepFunc))
+	msh.Go("second", mesh.BehaviorFunc(stepFunc))
+	msh.Go("last", mesh.BehaviorFunc(stepFunc))
+	msh.Subscribe("first", "second")
+	msh.Subscribe("second", "last")
+
+	evt, err := mesh.NewEvent("raw", mesh.WithCorrelationID("trace"))
+	assert.NoError(err)
+	assert.NoError(msh.EmitEvent("first", evt))
+	assert.Wait(sigc, []bool{true, true}, time.Second)
 
 	cancel()
 }
@@ -0,0 +1,149 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------
+// HISTOGRAM
+//--------------------
+
+// HistogramBounds are the upper bounds of the buckets of the
+// histograms measuring durations.
+var HistogramBounds = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram contains the distribution of measured durations. Counts
+// contains the number of durations per bucket, the last one counts
+// those greater than the last bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// histogram measures durations concurrently.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    int64
+}
+
+// newHistogram creates a histogram with the default bounds.
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, len(HistogramBounds)+1),
+	}
+}
+
+// observe adds a measured duration.
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(HistogramBounds) && d > HistogramBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	atomic.AddUint64(&h.count, 1)
+}
+
+// histogram returns the current distribution.
+func (h *histogram) histogram() Histogram {
+	hg := Histogram{
+		Bounds: HistogramBounds,
+		Counts: make([]uint64, len(h.counts)),
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		hg.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return hg
+}
+
+//--------------------
+// METRICS
+//--------------------
+
+// CellMetrics contains the metrics of a cell as returned by
+// Mesh.Metrics(). Received counts the events accepted by the queue,
+// Dropped the ones lost due to the queue policy. Undelivered counts
+// the emitted events which could not be delivered to a subscriber and
+// became dead letters. Errors counts the errors returned by the
+// behavior and the events rejected by interceptors. Processing
+// measures the time between the receiving of an event by the
+// behavior and its next pull. EmitWait measures the time emitters
+// are blocked by the full queue.
+type CellMetrics struct {
+	Name        string
+	Received    uint64
+	Emitted     uint64
+	Dropped     uint64
+	Undelivered uint64
+	Errors      uint64
+	Restarts    uint64
+	QueueLen    int
+	QueueCap    int
+	Processing  Histogram
+	EmitWait    Histogram
+}
+
+// metrics returns the metrics of the cell.
+func (c *cell) metrics() CellMetrics {
+	return CellMetrics{
+		Name:        c.name,
+		Received:    atomic.LoadUint64(&c.in.enqueued),
+		Emitted:     atomic.LoadUint64(&c.emitted),
+		Dropped:     atomic.LoadUint64(&c.in.dropped) + atomic.LoadUint64(&c.in.overflowed),
+		Undelivered: atomic.LoadUint64(&c.undelivered),
+		Errors:      atomic.LoadUint64(&c.errors),
+		Restarts:    atomic.LoadUint64(&c.restarts),
+		QueueLen:    c.in.len(),
+		QueueCap:    c.in.cfg.size,
+		Processing:  c.in.processing.histogram(),
+		EmitWait:    c.in.emitWait.histogram(),
+	}
+}
+
+// Metrics implements Mesh.
+func (m *mesh) Metrics() []CellMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	metrics := make([]CellMetrics, 0, len(m.cells))
+	for _, c := range m.cells {
+		metrics = append(metrics, c.metrics())
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// EOF
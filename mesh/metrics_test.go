@@ -0,0 +1,158 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestMetrics verifies the counters and histograms of the cells.
+func TestMetrics(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	releasec := make(chan struct{})
+	slowFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				switch evt.Topic() {
+				case "wait":
+					<-releasec
+				case "fail":
+					return errors.New("ouch")
+				}
+				time.Sleep(5 * time.Millisecond)
+				out.EmitEvent(evt)
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("slow", mesh.BehaviorFunc(slowFunc),
+		mesh.WithQueue(1, mesh.QueueBlock),
+		mesh.WithRestartPolicy(mesh.RestartPolicy{Strategy: mesh.RestartOnError}),
+	))
+	assert.NoError(msh.Go("dropping", mesh.BehaviorFunc(slowFunc), mesh.WithQueue(1, mesh.QueueDropNewest)))
+
+	// Blocked emitter waits for space in the queue.
+	for _, topic := range []string{"a", "b", "c", "fail", "d"} {
+		assert.NoError(msh.Emit("slow", topic))
+	}
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("slow")
+		return err == nil && info.Processed == 5 && info.QueueLen == 0
+	}, 100, 10*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	// Dropped events of the waiting cell.
+	assert.NoError(msh.Emit("dropping", "wait"))
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("dropping")
+		return err == nil && info.Processed == 1
+	}, 100, 10*time.Millisecond)
+	for _, topic := range []string{"a", "b", "c"} {
+		assert.NoError(msh.Emit("dropping", topic))
+	}
+
+	metrics := msh.Metrics()
+	assert.Length(metrics, 2)
+	dropping := metrics[0]
+	assert.Equal(dropping.Name, "dropping")
+	assert.Equal(dropping.Received, uint64(2))
+	assert.Equal(dropping.Dropped, uint64(2))
+	assert.Equal(dropping.QueueLen, 1)
+	assert.Equal(dropping.QueueCap, 1)
+	assert.Equal(dropping.EmitWait.Count, uint64(0))
+	close(releasec)
+
+	slow := metrics[1]
+	assert.Equal(slow.Name, "slow")
+	assert.Equal(slow.Received, uint64(5))
+	assert.Equal(slow.Emitted, uint64(6))
+	assert.Equal(slow.Dropped, uint64(0))
+	assert.Equal(slow.Errors, uint64(1))
+	assert.Equal(slow.Restarts, uint64(1))
+	assert.Equal(slow.QueueLen, 0)
+	assert.Equal(slow.Processing.Count, uint64(5))
+	assert.True(slow.Processing.Sum >= 20*time.Millisecond)
+	assert.Length(slow.Processing.Counts, len(mesh.HistogramBounds)+1)
+	assert.True(slow.EmitWait.Count > 0)
+	assert.True(slow.EmitWait.Sum > 0)
+	total := uint64(0)
+	for _, count := range slow.Processing.Counts {
+		total += count
+	}
+	assert.Equal(total, slow.Processing.Count)
+
+	assert.NoError(msh.Shutdown(ctx))
+}
+
+// TestMetricsLaneEmitWait verifies the measuring of the time an
+// emitting cell waits for the full queue of a subscriber.
+func TestMetricsLaneEmitWait(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	releasec := make(chan struct{})
+	waitFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case <-releasec:
+		}
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case <-in.Pull():
+			}
+		}
+	}
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("emitter", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Go("waiting", mesh.BehaviorFunc(waitFunc),
+		mesh.WithQueue(1, mesh.QueueBlock),
+		mesh.WithQueueTimeout(20*time.Millisecond),
+	))
+	assert.NoError(msh.Subscribe("emitter", "waiting"))
+
+	// Second event waits for the queue and times out.
+	assert.NoError(msh.Emit("emitter", "a"))
+	assert.NoError(msh.Emit("emitter", "b"))
+	var waiting mesh.CellMetrics
+	assert.Retry(func() bool {
+		waiting = msh.Metrics()[1]
+		return waiting.EmitWait.Count == 1
+	}, 100, 10*time.Millisecond)
+	assert.Equal(waiting.Name, "waiting")
+	assert.True(waiting.EmitWait.Sum >= 20*time.Millisecond)
+	assert.Equal(waiting.Dropped, uint64(1))
+	assert.Equal(msh.Metrics()[0].Undelivered, uint64(1))
+	close(releasec)
+
+	assert.NoError(msh.Shutdown(ctx))
+}
+
+// EOF
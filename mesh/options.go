@@ -0,0 +1,266 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+)
+
+//--------------------
+// MESH OPTIONS
+//--------------------
+
+// meshConfig contains the configuration of a mesh.
+type meshConfig struct {
+	codec        Codec
+	clock        Clock
+	snapshots    snapshotConfig
+	interceptors interceptorChain
+	tracer       Tracer
+	logger       Logger
+	deadLetters  deadLetterConfig
+}
+
+// snapshotConfig contains the store for the snapshots of the cells
+// and the interval they are taken.
+type snapshotConfig struct {
+	store    SnapshotStore
+	interval time.Duration
+}
+
+// newMeshConfig creates a mesh configuration with default values
+// and applies the options.
+func newMeshConfig(options ...MeshOption) *meshConfig {
+	cfg := &meshConfig{
+		codec:  defaultCodec,
+		clock:  defaultClock,
+		logger: defaultLogger,
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// MeshOption defines a function setting an option of a mesh
+// when it is created with New().
+type MeshOption func(cfg *meshConfig)
+
+// WithDefaultCodec sets the codec for the payloads of the events
+// created by the mesh and its cells. Single events can still use
+// an own codec with WithCodec(). By default it is JSON.
+func WithDefaultCodec(codec Codec) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.codec = codec
+	}
+}
+
+// WithClock sets the clock of the mesh and its cells. It is used
+// for the timestamps of new events, by the supervision of the cells,
+// and by the time-aware behaviors. By default it is the real clock,
+// tests can use a ManualClock.
+func WithClock(clock Clock) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.clock = clock
+	}
+}
+
+// WithSnapshots sets the store for the snapshots of the states of
+// behaviors implementing Snapshotter. When a cell is started its
+// behavior is restored out of an existing snapshot. The snapshots are
+// taken when the mesh is shut down and, if the interval is greater
+// than zero, periodically.
+func WithSnapshots(store SnapshotStore, interval time.Duration) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.snapshots.store = store
+		cfg.snapshots.interval = interval
+	}
+}
+
+// WithInterceptors adds interceptors for the events received and
+// emitted by all cells of the mesh. They are called in the order
+// they are added and before the ones of the single cells.
+func WithInterceptors(interceptors ...Interceptor) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.interceptors = append(cfg.interceptors, interceptors...)
+	}
+}
+
+// WithTracer sets the tracer creating spans for the emitting and the
+// processing of the events by the mesh and its cells. The span context
+// is propagated with the events. By default no spans are created.
+func WithTracer(tracer Tracer) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.tracer = tracer
+	}
+}
+
+// WithLogger sets the logger of the mesh. Each cell logs its lifecycle,
+// subscription changes, and lost events with its name and the type of its
+// behavior as tags. Behaviors can use it via Cell.Logger(). By default
+// nothing is logged.
+func WithLogger(logger Logger) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithDeadLetters sets the sink for the events which could not be
+// delivered to subscribed cells, e.g. a DeadLetterQueue.
+func WithDeadLetters(sink DeadLetterSink) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.deadLetters.sink = sink
+	}
+}
+
+// WithDeadLetterCell sets the name of the cell receiving the events
+// which could not be delivered to subscribed cells. They are wrapped
+// in events with the topic TopicDeadLetter and a DeadLetter as payload.
+func WithDeadLetterCell(name string) MeshOption {
+	return func(cfg *meshConfig) {
+		cfg.deadLetters.cell = name
+	}
+}
+
+//--------------------
+// CELL OPTIONS
+//--------------------
+
+// cellConfig contains the configuration of a cell.
+type cellConfig struct {
+	restart      RestartPolicy
+	queue        queueConfig
+	stopTimeout  time.Duration
+	codec        Codec
+	clock        Clock
+	parent       *cell
+	interceptors interceptorChain
+	tracer       Tracer
+	logger       Logger
+	deadLetters  func(dl DeadLetter)
+}
+
+// newCellConfig creates a cell configuration with default values
+// and applies the options.
+func newCellConfig(options ...CellOption) *cellConfig {
+	cfg := &cellConfig{
+		restart: RestartPolicy{
+			Strategy: RestartNever,
+		},
+		queue: queueConfig{
+			size:    defaultQueueSize,
+			policy:  QueueBlock,
+			timeout: defaultQueueTimeout,
+		},
+		stopTimeout: defaultStopTimeout,
+		codec:       defaultCodec,
+		clock:       defaultClock,
+		logger:      defaultLogger,
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// CellOption defines a function setting an option of a cell
+// when it is started with Mesh.Go().
+type CellOption func(cfg *cellConfig)
+
+// WithRestartPolicy sets the policy the cell is supervised with.
+// By default cells are never restarted.
+func WithRestartPolicy(policy RestartPolicy) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.restart = policy
+	}
+}
+
+// WithQueue sets the size of the input queue of the cell and the
+// policy for new events when it is full. By default the queue has a
+// size of 64 and emitters are blocked.
+func WithQueue(size int, policy QueuePolicy) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.queue.size = size
+		cfg.queue.policy = policy
+	}
+}
+
+// WithQueueTimeout sets how long emitters are blocked by a full
+// queue with policy QueueBlock. A timeout of zero or less lets them
+// wait until the queue has space again. The default is 5 seconds.
+func WithQueueTimeout(timeout time.Duration) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.queue.timeout = timeout
+	}
+}
+
+// WithStopTimeout sets how long stopping the cell via Mesh.Stop() or
+// by its terminating parent waits until its queued events are
+// processed and its behavior returned. The default is 10 seconds.
+func WithStopTimeout(timeout time.Duration) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.stopTimeout = timeout
+	}
+}
+
+// WithCellInterceptors adds interceptors for the events received
+// and emitted by the cell. They are called in the order they are added
+// and after the ones of the mesh.
+func WithCellInterceptors(interceptors ...Interceptor) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.interceptors = append(cfg.interceptors, interceptors...)
+	}
+}
+
+// withCodec sets the codec for events created by the cell.
+func withCodec(codec Codec) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.codec = codec
+	}
+}
+
+// withClock sets the clock of the cell.
+func withClock(clock Clock) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.clock = clock
+	}
+}
+
+// withTracer sets the tracer of the cell.
+func withTracer(tracer Tracer) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.tracer = tracer
+	}
+}
+
+// withLogger sets the logger of the cell.
+func withLogger(logger Logger) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.logger = logger
+	}
+}
+
+// withDeadLetters sets the handler for the dead letters of the cell.
+func withDeadLetters(deadLetters func(dl DeadLetter)) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.deadLetters = deadLetters
+	}
+}
+
+// withParent sets the parent of a cell started by a behavior.
+func withParent(parent *cell) CellOption {
+	return func(cfg *cellConfig) {
+		cfg.parent = parent
+	}
+}
+
+// EOF
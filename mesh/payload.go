@@ -15,6 +15,9 @@ package mesh // import "tideland.dev/go/cells/mesh"
 const (
 	TopicTerminated = "terminated"
 	TopicError      = "error"
+	TopicRestarted  = "restarted"
+	TopicGivenUp    = "given-up"
+	TopicDeadLetter = "dead-letter"
 
 	TopicTestbedDone       = "testbed-done"
 	TopicTestbedTerminated = "testbed-terminated"
@@ -36,4 +39,19 @@ type PayloadCellError struct {
 	Error    string `json:"error"`
 }
 
+// PayloadRestart describes the restart of a cell by its supervisor.
+type PayloadRestart struct {
+	CellName string `json:"cellName"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PayloadGiveUp describes a cell which has exceeded its restart
+// limit and is terminated.
+type PayloadGiveUp struct {
+	CellName string `json:"cellName"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error,omitempty"`
+}
+
 // EOF
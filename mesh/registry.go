@@ -0,0 +1,281 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+//--------------------
+// BEHAVIOR PARAMETERS
+//--------------------
+
+// BehaviorParams contains the parameters for the creation of a behavior
+// by a factory, e.g. read from a declarative topology. The accessors
+// return the default value if a key does not exist and an error if the
+// value has the wrong type.
+type BehaviorParams map[string]interface{}
+
+// Has checks if the parameter with the given key exists.
+func (p BehaviorParams) Has(key string) bool {
+	_, ok := p[key]
+	return ok
+}
+
+// String returns a string parameter.
+func (p BehaviorParams) String(key, def string) (string, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return def, p.invalid(key, "string")
+	}
+	return s, nil
+}
+
+// Bool returns a bool parameter.
+func (p BehaviorParams) Bool(key string, def bool) (bool, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return def, p.invalid(key, "bool")
+	}
+	return b, nil
+}
+
+// Int returns an integer parameter. Floats without fraction are
+// accepted too.
+func (p BehaviorParams) Int(key string, def int) (int, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	switch tv := v.(type) {
+	case int:
+		return tv, nil
+	case int64:
+		return int(tv), nil
+	case uint64:
+		return int(tv), nil
+	case float64:
+		if tv == math.Trunc(tv) {
+			return int(tv), nil
+		}
+	case json.Number:
+		if i, err := tv.Int64(); err == nil {
+			return int(i), nil
+		}
+	}
+	return def, p.invalid(key, "int")
+}
+
+// Float returns a float parameter.
+func (p BehaviorParams) Float(key string, def float64) (float64, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	switch tv := v.(type) {
+	case float64:
+		return tv, nil
+	case int:
+		return float64(tv), nil
+	case int64:
+		return float64(tv), nil
+	case uint64:
+		return float64(tv), nil
+	case json.Number:
+		if f, err := tv.Float64(); err == nil {
+			return f, nil
+		}
+	}
+	return def, p.invalid(key, "float")
+}
+
+// Duration returns a duration parameter. It has to be a string like
+// "1.5s" or "100ms".
+func (p BehaviorParams) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return def, p.invalid(key, "duration")
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def, p.invalid(key, "duration")
+	}
+	return d, nil
+}
+
+// Strings returns a list of strings parameter. A single string is
+// returned as list with one element.
+func (p BehaviorParams) Strings(key string, def []string) ([]string, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	switch tv := v.(type) {
+	case string:
+		return []string{tv}, nil
+	case []string:
+		return tv, nil
+	case []interface{}:
+		ss := make([]string, len(tv))
+		for i, e := range tv {
+			s, ok := e.(string)
+			if !ok {
+				return def, p.invalid(key, "list of strings")
+			}
+			ss[i] = s
+		}
+		return ss, nil
+	}
+	return def, p.invalid(key, "list of strings")
+}
+
+// StringMap returns a map of strings parameter.
+func (p BehaviorParams) StringMap(key string, def map[string]string) (map[string]string, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	switch tv := v.(type) {
+	case map[string]string:
+		return tv, nil
+	case map[string]interface{}:
+		sm := make(map[string]string, len(tv))
+		for k, e := range tv {
+			s, ok := e.(string)
+			if !ok {
+				return def, p.invalid(key, "map of strings")
+			}
+			sm[k] = s
+		}
+		return sm, nil
+	}
+	return def, p.invalid(key, "map of strings")
+}
+
+// invalid returns the error for a parameter with a wrong type.
+func (p BehaviorParams) invalid(key, kind string) error {
+	return fmt.Errorf("parameter '%s' is no valid %s: %v", key, kind, p[key])
+}
+
+//--------------------
+// BEHAVIOR REGISTRY
+//--------------------
+
+// BehaviorFactory creates a behavior based on the given parameters.
+type BehaviorFactory func(params BehaviorParams) (Behavior, error)
+
+// BehaviorRegistry maps kinds of behaviors to their factories. So
+// behaviors can be created by name, e.g. when building a mesh out of
+// a declarative topology.
+type BehaviorRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]BehaviorFactory
+}
+
+// NewBehaviorRegistry creates an empty behavior registry.
+func NewBehaviorRegistry() *BehaviorRegistry {
+	return &BehaviorRegistry{
+		factories: make(map[string]BehaviorFactory),
+	}
+}
+
+// Register adds a factory for the given kind of behavior.
+func (r *BehaviorRegistry) Register(kind string, factory BehaviorFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if kind == "" {
+		return fmt.Errorf("behavior kind must not be empty")
+	}
+	if factory == nil {
+		return fmt.Errorf("factory for behavior kind '%s' is nil", kind)
+	}
+	if r.factories[kind] != nil {
+		return fmt.Errorf("behavior kind '%s' already registered", kind)
+	}
+	r.factories[kind] = factory
+	return nil
+}
+
+// Has checks if a factory for the given kind is registered.
+func (r *BehaviorRegistry) Has(kind string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.factories[kind] != nil
+}
+
+// Kinds returns the sorted kinds of all registered behaviors.
+func (r *BehaviorRegistry) Kinds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kinds := make([]string, 0, len(r.factories))
+	for kind := range r.factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Create creates a behavior of the given kind with the parameters.
+func (r *BehaviorRegistry) Create(kind string, params BehaviorParams) (Behavior, error) {
+	r.mu.RLock()
+	factory := r.factories[kind]
+	r.mu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("behavior kind '%s' is not registered", kind)
+	}
+	if params == nil {
+		params = BehaviorParams{}
+	}
+	b, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create behavior kind '%s': %v", kind, err)
+	}
+	return b, nil
+}
+
+// behaviors is the registry the packages of behaviors register
+// their factories at.
+var behaviors = NewBehaviorRegistry()
+
+// DefaultBehaviorRegistry returns the registry the behaviors of the
+// behaviors packages register at when they are imported.
+func DefaultBehaviorRegistry() *BehaviorRegistry {
+	return behaviors
+}
+
+// RegisterBehavior registers a factory for the given kind at the
+// default registry. It is intended to be called in init() functions
+// and panics if the kind is invalid or already registered.
+func RegisterBehavior(kind string, factory BehaviorFactory) {
+	if err := behaviors.Register(kind, factory); err != nil {
+		panic(err)
+	}
+}
+
+// EOF
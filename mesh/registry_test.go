@@ -0,0 +1,121 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestBehaviorParams verifies the typed access to behavior parameters.
+func TestBehaviorParams(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	params := mesh.BehaviorParams{
+		"name":     "foo",
+		"enabled":  true,
+		"count":    3.0,
+		"size":     7,
+		"ratio":    0.5,
+		"timeout":  "250ms",
+		"topics":   []interface{}{"a.*", "b.**"},
+		"topic":    "c",
+		"renaming": map[string]interface{}{"a": "b"},
+	}
+
+	s, err := params.String("name", "")
+	assert.NoError(err)
+	assert.Equal(s, "foo")
+	s, err = params.String("missing", "default")
+	assert.NoError(err)
+	assert.Equal(s, "default")
+	_, err = params.String("count", "")
+	assert.ErrorContains(err, "parameter 'count' is no valid string")
+
+	b, err := params.Bool("enabled", false)
+	assert.NoError(err)
+	assert.True(b)
+
+	i, err := params.Int("count", 0)
+	assert.NoError(err)
+	assert.Equal(i, 3)
+	i, err = params.Int("size", 0)
+	assert.NoError(err)
+	assert.Equal(i, 7)
+	_, err = params.Int("ratio", 0)
+	assert.ErrorContains(err, "parameter 'ratio' is no valid int")
+
+	f, err := params.Float("ratio", 0.0)
+	assert.NoError(err)
+	assert.Equal(f, 0.5)
+
+	d, err := params.Duration("timeout", time.Second)
+	assert.NoError(err)
+	assert.Equal(d, 250*time.Millisecond)
+	_, err = params.Duration("name", time.Second)
+	assert.ErrorContains(err, "parameter 'name' is no valid duration")
+
+	ss, err := params.Strings("topics", nil)
+	assert.NoError(err)
+	assert.Equal(ss, []string{"a.*", "b.**"})
+	ss, err = params.Strings("topic", nil)
+	assert.NoError(err)
+	assert.Equal(ss, []string{"c"})
+
+	sm, err := params.StringMap("renaming", nil)
+	assert.NoError(err)
+	assert.Equal(sm, map[string]string{"a": "b"})
+	_, err = params.StringMap("topics", nil)
+	assert.ErrorContains(err, "parameter 'topics' is no valid map of strings")
+}
+
+// TestBehaviorRegistry verifies registering and creating behaviors.
+func TestBehaviorRegistry(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	registry := mesh.NewBehaviorRegistry()
+	factory := func(params mesh.BehaviorParams) (mesh.Behavior, error) {
+		if params.Has("fail") {
+			return nil, errors.New("failing")
+		}
+		return mesh.BehaviorFunc(func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+			<-cell.Context().Done()
+			return nil
+		}), nil
+	}
+
+	assert.NoError(registry.Register("waiter", factory))
+	assert.NoError(registry.Register("another", factory))
+	assert.ErrorContains(registry.Register("waiter", factory), "behavior kind 'waiter' already registered")
+	assert.ErrorContains(registry.Register("", factory), "behavior kind must not be empty")
+	assert.ErrorContains(registry.Register("nil", nil), "factory for behavior kind 'nil' is nil")
+	assert.True(registry.Has("waiter"))
+	assert.False(registry.Has("dont-exist"))
+	assert.Equal(registry.Kinds(), []string{"another", "waiter"})
+
+	b, err := registry.Create("waiter", nil)
+	assert.NoError(err)
+	assert.NotNil(b)
+	_, err = registry.Create("waiter", mesh.BehaviorParams{"fail": true})
+	assert.ErrorContains(err, "cannot create behavior kind 'waiter': failing")
+	_, err = registry.Create("dont-exist", nil)
+	assert.ErrorContains(err, "behavior kind 'dont-exist' is not registered")
+}
+
+// EOF
@@ -0,0 +1,220 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//--------------------
+// ERRORS
+//--------------------
+
+// SnapshotError collects the errors of the cells whose snapshots
+// could not be taken. The snapshots of the other cells are saved.
+type SnapshotError struct {
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (e *SnapshotError) Error() string {
+	return "snapshot errors: " + formatCellErrors(e.Errors)
+}
+
+//--------------------
+// SNAPSHOTTER
+//--------------------
+
+// Snapshotter is implemented by behaviors whose state can be saved
+// and restored, so that it survives restarts of the program. Both
+// methods may be called while the behavior is running, so they have
+// to synchronize with the processing of the events.
+type Snapshotter interface {
+	// Snapshot returns the current state of the behavior.
+	Snapshot() ([]byte, error)
+
+	// Restore replaces the state of the behavior with the one
+	// returned by Snapshot().
+	Restore(data []byte) error
+}
+
+//--------------------
+// SNAPSHOT STORE
+//--------------------
+
+// SnapshotStore persists the snapshots of the cells by their names.
+type SnapshotStore interface {
+	// Save stores the snapshot of the named cell.
+	Save(name string, data []byte) error
+
+	// Load returns the snapshot of the named cell. If none exists
+	// it returns nil data and no error.
+	Load(name string) ([]byte, error)
+}
+
+// FileSnapshotStore stores each snapshot in a file of a directory.
+type FileSnapshotStore struct {
+	dir string
+}
+
+var _ SnapshotStore = (*FileSnapshotStore)(nil)
+
+// NewFileSnapshotStore creates a snapshot store using the directory.
+// It is created if needed.
+func NewFileSnapshotStore(dir string) (*FileSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create snapshot directory: %v", err)
+	}
+	return &FileSnapshotStore{
+		dir: dir,
+	}, nil
+}
+
+// Save implements SnapshotStore. The snapshot is written into a
+// temporary file first, so that a failing write doesn't destroy
+// the former snapshot.
+func (s *FileSnapshotStore) Save(name string, data []byte) error {
+	filename := s.filename(name)
+	tmpname := filename + ".tmp"
+	if err := os.WriteFile(tmpname, data, 0644); err != nil {
+		return fmt.Errorf("cannot write snapshot of cell '%s': %v", name, err)
+	}
+	if err := os.Rename(tmpname, filename); err != nil {
+		return fmt.Errorf("cannot write snapshot of cell '%s': %v", name, err)
+	}
+	return nil
+}
+
+// Load implements SnapshotStore.
+func (s *FileSnapshotStore) Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(s.filename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snapshot of cell '%s': %v", name, err)
+	}
+	return data, nil
+}
+
+// filename returns the name of the snapshot file of the named cell.
+func (s *FileSnapshotStore) filename(name string) string {
+	return filepath.Join(s.dir, url.QueryEscape(name)+".snapshot")
+}
+
+//--------------------
+// MESH SNAPSHOTS
+//--------------------
+
+// Snapshot implements Mesh.
+func (m *mesh) Snapshot() error {
+	if m.cfg.snapshots.store == nil {
+		return errors.New("no snapshot store configured")
+	}
+	m.mu.RLock()
+	names := make([]string, 0, len(m.cells))
+	for name := range m.cells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cells := make([]*cell, len(names))
+	for i, name := range names {
+		cells[i] = m.cells[name]
+	}
+	m.mu.RUnlock()
+	errs := make(map[string]error)
+	for _, c := range cells {
+		if err := m.snapshotCell(c); err != nil {
+			errs[c.name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return &SnapshotError{
+			Errors: errs,
+		}
+	}
+	return nil
+}
+
+// Restore implements Mesh.
+func (m *mesh) Restore() error {
+	if m.cfg.snapshots.store == nil {
+		return errors.New("no snapshot store configured")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, c := range m.cells {
+		if err := m.restoreBehavior(name, c.behavior); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotCell saves the snapshot of the cell if its behavior is
+// a Snapshotter.
+func (m *mesh) snapshotCell(c *cell) error {
+	s, ok := c.behavior.(Snapshotter)
+	if !ok {
+		return nil
+	}
+	data, err := s.Snapshot()
+	if err != nil {
+		return fmt.Errorf("cannot take snapshot of cell '%s': %v", c.name, err)
+	}
+	return m.cfg.snapshots.store.Save(c.name, data)
+}
+
+// restoreBehavior restores the state of the behavior out of the
+// snapshot of the named cell if one exists.
+func (m *mesh) restoreBehavior(name string, b Behavior) error {
+	s, ok := b.(Snapshotter)
+	if !ok {
+		return nil
+	}
+	data, err := m.cfg.snapshots.store.Load(name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	if err := s.Restore(data); err != nil {
+		return fmt.Errorf("cannot restore snapshot of cell '%s': %v", name, err)
+	}
+	return nil
+}
+
+// snapshotLoop takes the snapshots periodically until the context
+// is done. Failed snapshots are tried again with the next tick.
+func (m *mesh) snapshotLoop(ctx context.Context) {
+	ticker := m.cfg.clock.NewTicker(m.cfg.snapshots.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := m.Snapshot(); err != nil {
+				m.cfg.logger.Error("cannot take snapshots", "error", err)
+			}
+		}
+	}
+}
+
+// EOF
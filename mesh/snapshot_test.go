@@ -0,0 +1,172 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestFileSnapshotStore verifies storing snapshots in files.
+func TestFileSnapshotStore(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	store, err := mesh.NewFileSnapshotStore(dir)
+	assert.NoError(err)
+
+	data, err := store.Load("dont-exist")
+	assert.NoError(err)
+	assert.Nil(data)
+
+	assert.NoError(store.Save("a/b:c", []byte("first")))
+	assert.NoError(store.Save("a/b:c", []byte("second")))
+	data, err = store.Load("a/b:c")
+	assert.NoError(err)
+	assert.Equal(string(data), "second")
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NoError(err)
+	assert.Length(matches, 1)
+}
+
+// TestMeshSnapshots verifies snapshots and restoring of all cells
+// implementing Snapshotter.
+func TestMeshSnapshots(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx := context.Background()
+	store, err := mesh.NewFileSnapshotStore(t.TempDir())
+	assert.NoError(err)
+
+	msh := mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	first := &summer{}
+	assert.NoError(msh.Go("summer", first))
+	assert.NoError(msh.Go("plain", mesh.NewRequestBehavior(func(cell mesh.Cell, evt *mesh.Event, out mesh.Emitter) error {
+		return nil
+	})))
+	assert.NoError(msh.Emit("summer", "add", 1))
+	assert.NoError(msh.Emit("summer", "add", 2))
+	assert.NoError(msh.Shutdown(ctx))
+	data, err := store.Load("summer")
+	assert.NoError(err)
+	assert.Equal(string(data), "3")
+	data, err = store.Load("plain")
+	assert.NoError(err)
+	assert.Nil(data)
+
+	// New cell is restored when started.
+	msh = mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	second := &summer{}
+	assert.NoError(msh.Go("summer", second))
+	assert.Equal(second.value(), 3)
+	assert.NoError(msh.Emit("summer", "add", 4))
+	assert.NoError(msh.Shutdown(ctx))
+	data, err = store.Load("summer")
+	assert.NoError(err)
+	assert.Equal(string(data), "7")
+
+	// Failing snapshots and restores.
+	assert.NoError(store.Save("broken", []byte("x")))
+	msh = mesh.New(ctx, mesh.WithSnapshots(store, 0))
+	err = msh.Go("broken", &summer{})
+	assert.ErrorContains(err, "cannot restore snapshot of cell 'broken'")
+	assert.NoError(msh.Go("failing", &summer{fail: true}))
+	assert.NoError(msh.Go("also-failing", &summer{fail: true}))
+	working := &summer{}
+	assert.NoError(msh.Go("working", working))
+	assert.NoError(msh.Emit("working", "add", 5))
+	assert.Retry(func() bool {
+		return working.value() == 5
+	}, 100, 10*time.Millisecond)
+	err = msh.Snapshot()
+	var serr *mesh.SnapshotError
+	assert.True(errors.As(err, &serr))
+	assert.Length(serr.Errors, 2)
+	assert.Equal(err.Error(), "snapshot errors: "+
+		"cell 'also-failing': cannot take snapshot of cell 'also-failing': ouch; "+
+		"cell 'failing': cannot take snapshot of cell 'failing': ouch")
+	data, err = store.Load("working")
+	assert.NoError(err)
+	assert.Equal(string(data), "5")
+	err = msh.Shutdown(ctx)
+	assert.ErrorContains(err, "cell 'failing': cannot take snapshot of cell 'failing': ouch")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// summer is a behavior summing up the payloads of the events. The
+// sum is its snapshot.
+type summer struct {
+	mu   sync.Mutex
+	sum  int
+	fail bool
+}
+
+// Go implements mesh.Behavior.
+func (s *summer) Go(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			value, err := mesh.PayloadAs[int](evt)
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.sum += value
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Snapshot implements mesh.Snapshotter.
+func (s *summer) Snapshot() ([]byte, error) {
+	if s.fail {
+		return nil, errors.New("ouch")
+	}
+	return []byte(strconv.Itoa(s.value())), nil
+}
+
+// Restore implements mesh.Snapshotter.
+func (s *summer) Restore(data []byte) error {
+	sum, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sum = sum
+	return nil
+}
+
+// value returns the current sum.
+func (s *summer) value() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sum
+}
+
+// EOF
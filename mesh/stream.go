@@ -12,7 +12,10 @@ package mesh // import "tideland.dev/go/cells/mesh"
 //--------------------
 
 import (
-	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,7 +25,9 @@ import (
 
 // Receptor defines the interface to receive events.
 type Receptor interface {
-	// Pull reads an event out of the input stream.
+	// Pull reads an event out of the input stream. It has to be
+	// called for each receiving as the next event is handed over
+	// only after the behavior asked for it.
 	Pull() <-chan *Event
 }
 
@@ -36,25 +41,162 @@ type Emitter interface {
 	EmitEvent(evt *Event) error
 }
 
+//--------------------
+// QUEUE POLICY
+//--------------------
+
+// QueuePolicy defines how the input queue of a cell handles new
+// events when it is full.
+type QueuePolicy int
+
+// Queue policies.
+const (
+	// QueueBlock lets the emitter wait until the queue has space
+	// again or the timeout is reached.
+	QueueBlock QueuePolicy = iota
+
+	// QueueDropNewest silently drops the new event.
+	QueueDropNewest
+
+	// QueueDropOldest silently drops the oldest queued event to
+	// make space for the new one.
+	QueueDropOldest
+
+	// QueueFailFast immediately returns an error to the emitter.
+	QueueFailFast
+)
+
+// String implements fmt.Stringer.
+func (p QueuePolicy) String() string {
+	switch p {
+	case QueueBlock:
+		return "block"
+	case QueueDropNewest:
+		return "drop-newest"
+	case QueueDropOldest:
+		return "drop-oldest"
+	case QueueFailFast:
+		return "fail-fast"
+	}
+	return fmt.Sprintf("QueuePolicy(%d)", int(p))
+}
+
+// QueueOverflowError is returned when an event cannot be appended
+// to the full input queue of a cell.
+type QueueOverflowError struct {
+	CellName string
+	Policy   QueuePolicy
+	Size     int
+}
+
+// Error implements the error interface.
+func (e *QueueOverflowError) Error() string {
+	if e.Policy == QueueBlock {
+		return fmt.Sprintf("queue of cell '%s' overflow: timeout after waiting for space", e.CellName)
+	}
+	return fmt.Sprintf("queue of cell '%s' overflow: %d events queued (%v)", e.CellName, e.Size, e.Policy)
+}
+
 //--------------------
 // STREAM
 //--------------------
 
-// stream manages the flow of events between emitter and receiver.
+// Default queue configuration.
+const (
+	defaultQueueSize    = 64
+	defaultQueueTimeout = 5 * time.Second
+)
+
+// queueConfig contains size, policy, and timeout of a stream.
+type queueConfig struct {
+	size    int
+	policy  QueuePolicy
+	timeout time.Duration
+}
+
+// stream manages the flow of events between emitter and receiver
+// using a bounded queue. The events are handed over one by one only
+// after the receiver pulled again. So the stream knows which event is
+// currently processed. Each queued event holds a slot, also the ones
+// still on their way through the lanes of the emitting cells.
 type stream struct {
-	eventc chan *Event
+	enqueued   uint64
+	dropped    uint64
+	overflowed uint64
+	name       string
+	cfg        queueConfig
+	eventc     chan *Event
+	slots      chan struct{}
+	pullc      chan *Event
+	readyc     chan struct{}
+	pulledc    chan struct{}
+	donec      chan struct{}
+	doneOnce   sync.Once
+	mu         sync.Mutex
+	ready      bool
+	staged     *Event
+	stagedAt   time.Time
+	stagedSeq  uint64
+	pullSeq    uint64
+	pullFull   bool
+	pulledAt   time.Time
+	processing *histogram
+	emitWait   *histogram
+	tracer     Tracer
+	span       Span
+	logger     Logger
 }
 
-// newStream creates a stream instance.
-func newStream() *stream {
-	return &stream{
-		eventc: make(chan *Event),
+// newStream creates a stream instance for the named cell.
+func newStream(name string, cfg queueConfig) *stream {
+	if cfg.size < 1 {
+		cfg.size = 1
+	}
+	str := &stream{
+		name:       name,
+		cfg:        cfg,
+		eventc:     make(chan *Event, cfg.size),
+		slots:      make(chan struct{}, cfg.size),
+		pullc:      make(chan *Event, 1),
+		readyc:     make(chan struct{}, 1),
+		pulledc:    make(chan struct{}, 1),
+		donec:      make(chan struct{}),
+		processing: newHistogram(),
+		emitWait:   newHistogram(),
+		logger:     defaultLogger,
 	}
+	go str.handover()
+	return str
 }
 
-// Pull reads an event out of the stream.
+// Pull reads an event out of the stream. It signals the readiness
+// of the receiver to the handover. The time since the receiving of
+// the former event is measured as its processing time and ends its
+// span.
 func (str *stream) Pull() <-chan *Event {
-	return str.eventc
+	now := time.Now()
+	str.mu.Lock()
+	defer str.mu.Unlock()
+	full := len(str.pullc) > 0
+	if str.received() {
+		// Staged event has been received after the last pull
+		// or its handover.
+		start := str.stagedAt
+		if str.pulledAt.After(start) {
+			start = str.pulledAt
+		}
+		str.processing.observe(now.Sub(start))
+		str.endSpan()
+	}
+	str.pulledAt = now
+	if !full && !str.ready {
+		str.ready = true
+		str.readyc <- struct{}{}
+	}
+	str.pullSeq = str.stagedSeq
+	str.pullFull = full
+	str.signal()
+	return str.pullc
 }
 
 // Emit creates a new event and emits it.
@@ -66,26 +208,225 @@ func (str *stream) Emit(topic string, payloads ...interface{}) error {
 	return str.EmitEvent(evt)
 }
 
-// EmitEvent appends an event to the end of the stream. It retries to
-// append it to the buffer in case that it's full. The time will
-// increase. If waiting is longer than 5 seconds a timeout error will
-// be returned.
+// EmitEvent appends an event to the end of the stream. If the queue
+// is full its policy decides what happens. Lost events are logged.
 func (str *stream) EmitEvent(evt *Event) error {
-	total := 5 * time.Second
-	wait := 50 * time.Millisecond
-	waited := 0 * time.Millisecond
+	admitted, err := str.admit(evt, nil, str.dropOldest)
+	if !admitted {
+		return err
+	}
+	return str.enqueue(evt)
+}
+
+// admit reserves a slot in the queue for the event. If the queue is
+// full its policy decides what happens. Dropping the oldest event is
+// done by the passed function, it returns false if there's nothing to
+// drop. Waiting for a slot ends if the cancel channel is closed. It
+// returns if the event is admitted or the error if it is rejected.
+// Dropped or cancelled events return no error.
+func (str *stream) admit(evt *Event, cancelc <-chan struct{}, dropOldest func() bool) (bool, error) {
+	select {
+	case <-str.donec:
+		return false, errCellDeactivated
+	case str.slots <- struct{}{}:
+		return true, nil
+	default:
+	}
+	switch str.cfg.policy {
+	case QueueDropNewest:
+		atomic.AddUint64(&str.overflowed, 1)
+		str.logger.Warn("event dropped", "topic", evt.Topic(), "policy", str.cfg.policy)
+		return false, nil
+	case QueueDropOldest:
+		for {
+			if !dropOldest() {
+				// Queued events are still on their way.
+				runtime.Gosched()
+			}
+			select {
+			case <-str.donec:
+				return false, errCellDeactivated
+			case str.slots <- struct{}{}:
+				return true, nil
+			default:
+			}
+		}
+	case QueueFailFast:
+		atomic.AddUint64(&str.overflowed, 1)
+		str.logger.Warn("event rejected by full queue", "topic", evt.Topic(), "policy", str.cfg.policy)
+		return false, str.overflow()
+	}
+	// Block until space, timeout, or end.
+	start := time.Now()
+	defer func() {
+		str.emitWait.observe(time.Since(start))
+	}()
+	var timeoutc <-chan time.Time
+	if str.cfg.timeout > 0 {
+		timer := time.NewTimer(str.cfg.timeout)
+		defer timer.Stop()
+		timeoutc = timer.C
+	}
+	select {
+	case <-cancelc:
+		return false, nil
+	case <-str.donec:
+		return false, errCellDeactivated
+	case str.slots <- struct{}{}:
+		return true, nil
+	case <-timeoutc:
+		atomic.AddUint64(&str.overflowed, 1)
+		str.logger.Warn("emit timed out", "topic", evt.Topic(), "timeout", str.cfg.timeout)
+		return false, str.overflow()
+	}
+}
+
+// release frees the slot of an event leaving the queue.
+func (str *stream) release() {
+	select {
+	case <-str.slots:
+	default:
+	}
+}
+
+// dropOldest removes the oldest event out of the queue. It returns
+// false if there is none.
+func (str *stream) dropOldest() bool {
+	select {
+	case dropped := <-str.eventc:
+		str.release()
+		atomic.AddUint64(&str.dropped, 1)
+		str.logger.Warn("event dropped", "topic", dropped.Topic(), "policy", str.cfg.policy)
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue appends an event with an admitted slot to the end of the
+// stream.
+func (str *stream) enqueue(evt *Event) error {
+	select {
+	case <-str.donec:
+		return errCellDeactivated
+	case str.eventc <- evt:
+		atomic.AddUint64(&str.enqueued, 1)
+		return nil
+	}
+}
+
+// handover runs as goroutine and passes the queued events to the
+// receiver each time it is ready.
+func (str *stream) handover() {
 	for {
 		select {
-		case str.eventc <- evt:
-			return nil
-		default:
-			time.Sleep(wait)
-			waited += wait
-			wait += 50 * time.Millisecond
-			if waited > total {
-				return errors.New("timeout")
-			}
+		case <-str.donec:
+			return
+		case <-str.readyc:
 		}
+		var evt *Event
+		select {
+		case <-str.donec:
+			return
+		case evt = <-str.eventc:
+		}
+		str.release()
+		str.mu.Lock()
+		if str.tracer != nil {
+			evt, str.span = startSpan(str.tracer, SpanProcess, str.name, evt)
+		}
+		str.ready = false
+		str.staged = evt
+		str.stagedAt = time.Now()
+		str.stagedSeq++
+		str.pullc <- evt
+		str.mu.Unlock()
+	}
+}
+
+// current returns the event the receiver is processing since its
+// last pull, or nil if it received none.
+func (str *stream) current() *Event {
+	str.mu.Lock()
+	defer str.mu.Unlock()
+	if str.received() {
+		return str.staged
+	}
+	return nil
+}
+
+// received checks if the staged event has been received since the
+// last pull. It has to be called with locked mutex.
+func (str *stream) received() bool {
+	if len(str.pullc) > 0 {
+		// Staged event not yet received.
+		return false
+	}
+	return str.pullFull || str.stagedSeq > str.pullSeq
+}
+
+// fail marks the span of the currently processed event as failed.
+func (str *stream) fail(err error) {
+	str.mu.Lock()
+	defer str.mu.Unlock()
+	if str.span != nil && str.received() {
+		str.span.SetError(err)
+	}
+}
+
+// endSpan ends the span of the event processed since the last pull.
+// It has to be called with locked mutex.
+func (str *stream) endSpan() {
+	if str.span != nil {
+		str.span.End()
+		str.span = nil
+	}
+}
+
+// signal tells a waiting stop that the number of queued events
+// may have changed.
+func (str *stream) signal() {
+	select {
+	case str.pulledc <- struct{}{}:
+	default:
+	}
+}
+
+// len returns the number of queued events not yet received.
+func (str *stream) len() int {
+	received := str.pulled()
+	removed := atomic.LoadUint64(&str.dropped) + received
+	enqueued := atomic.LoadUint64(&str.enqueued)
+	if enqueued < removed {
+		return 0
+	}
+	return int(enqueued - removed)
+}
+
+// pulled returns the number of events received out of the stream.
+func (str *stream) pulled() uint64 {
+	str.mu.Lock()
+	defer str.mu.Unlock()
+	return str.stagedSeq - uint64(len(str.pullc))
+}
+
+// close releases all emitters waiting for space and ends the span
+// of the currently processed event.
+func (str *stream) close() {
+	str.doneOnce.Do(func() {
+		close(str.donec)
+		str.mu.Lock()
+		defer str.mu.Unlock()
+		str.endSpan()
+	})
+}
+
+// overflow returns the error for a full queue.
+func (str *stream) overflow() error {
+	return &QueueOverflowError{
+		CellName: str.name,
+		Policy:   str.cfg.policy,
+		Size:     str.cfg.size,
 	}
 }
 
@@ -13,8 +13,10 @@ package mesh // import "tideland.dev/go/cells/mesh"
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"tideland.dev/go/audit/asserts"
 )
@@ -28,7 +30,7 @@ import (
 func TestStreamSimple(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	ctx, cancel := context.WithCancel(context.Background())
-	str := newStream()
+	str := newStream("test", queueConfig{size: 4})
 	topics := []string{"one", "two", "three", "four", "five"}
 
 	var wg sync.WaitGroup
@@ -57,4 +59,71 @@ func TestStreamSimple(t *testing.T) {
 	cancel()
 }
 
+// TestStreamPolicies verifies the different handlings of a full queue.
+func TestStreamPolicies(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	topics := func(str *stream) []string {
+		var ts []string
+		for str.len() > 0 {
+			ts = append(ts, (<-str.Pull()).Topic())
+		}
+		return ts
+	}
+
+	// Drop newest.
+	str := newStream("test", queueConfig{size: 2, policy: QueueDropNewest})
+	assert.NoError(str.Emit("one"))
+	assert.NoError(str.Emit("two"))
+	assert.NoError(str.Emit("three"))
+	assert.Equal(topics(str), []string{"one", "two"})
+
+	// Drop oldest.
+	str = newStream("test", queueConfig{size: 2, policy: QueueDropOldest})
+	assert.NoError(str.Emit("one"))
+	assert.NoError(str.Emit("two"))
+	assert.NoError(str.Emit("three"))
+	assert.Equal(topics(str), []string{"two", "three"})
+
+	// Fail fast.
+	str = newStream("test", queueConfig{size: 2, policy: QueueFailFast})
+	assert.NoError(str.Emit("one"))
+	assert.NoError(str.Emit("two"))
+	err := str.Emit("three")
+	var qoerr *QueueOverflowError
+	assert.True(errors.As(err, &qoerr))
+	assert.Equal(qoerr.CellName, "test")
+	assert.Equal(qoerr.Policy, QueueFailFast)
+	assert.Equal(topics(str), []string{"one", "two"})
+}
+
+// TestStreamBlocking verifies the waiting of emitters for a full queue.
+func TestStreamBlocking(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	// Timeout.
+	str := newStream("test", queueConfig{size: 1, policy: QueueBlock, timeout: 10 * time.Millisecond})
+	assert.NoError(str.Emit("one"))
+	err := str.Emit("two")
+	assert.ErrorContains(err, "timeout")
+
+	// Waiting for space.
+	str = newStream("test", queueConfig{size: 1, policy: QueueBlock})
+	assert.NoError(str.Emit("one"))
+	errc := make(chan error, 1)
+	go func() {
+		errc <- str.Emit("two")
+	}()
+	assert.Equal((<-str.Pull()).Topic(), "one")
+	assert.NoError(<-errc)
+	assert.Equal((<-str.Pull()).Topic(), "two")
+
+	// Closing.
+	assert.NoError(str.Emit("three"))
+	go func() {
+		errc <- str.Emit("four")
+	}()
+	str.close()
+	assert.True(errors.Is(<-errc, errCellDeactivated))
+}
+
 // EOF
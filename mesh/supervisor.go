@@ -0,0 +1,139 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+)
+
+//--------------------
+// RESTART POLICY
+//--------------------
+
+// RestartStrategy defines when a cell is restarted after its
+// behavior returned.
+type RestartStrategy int
+
+// Restart strategies.
+const (
+	// RestartNever lets the cell terminate when the behavior returns.
+	RestartNever RestartStrategy = iota
+
+	// RestartAlways restarts the behavior whenever it returns while
+	// the cell context is still active.
+	RestartAlways
+
+	// RestartOnError restarts the behavior only if it returns an error.
+	RestartOnError
+)
+
+// RestartPolicy describes how a cell is supervised. MaxRestarts limits the
+// number of restarts inside of Window, a value of zero or less means
+// no limit, a Window of zero counts all restarts. Before each restart
+// the cell waits Backoff, doubled per restart inside the window, up to
+// MaxBackoff if set.
+type RestartPolicy struct {
+	Strategy    RestartStrategy
+	MaxRestarts int
+	Window      time.Duration
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+//--------------------
+// SUPERVISOR
+//--------------------
+
+// decision tells the cell what to do after the behavior returned.
+type decision int
+
+// Decisions of the supervisor.
+const (
+	decisionStop decision = iota
+	decisionRestart
+	decisionGiveUp
+)
+
+// supervisor decides about restarts of a cell based on its policy.
+// The times of the restarts are only kept if the policy has a window,
+// otherwise the total number of restarts is enough.
+type supervisor struct {
+	policy   RestartPolicy
+	restarts []time.Time
+	total    int
+}
+
+// newSupervisor creates a supervisor for the given policy.
+func newSupervisor(policy RestartPolicy) *supervisor {
+	return &supervisor{
+		policy: policy,
+	}
+}
+
+// next returns the decision for the behavior result err at time now and,
+// in case of a restart, the duration to wait before.
+func (s *supervisor) next(err error, now time.Time) (decision, time.Duration) {
+	switch s.policy.Strategy {
+	case RestartAlways:
+	case RestartOnError:
+		if err == nil {
+			return decisionStop, 0
+		}
+	default:
+		return decisionStop, 0
+	}
+	n := s.total
+	if s.policy.Window > 0 {
+		// Only keep the restarts inside the window.
+		limit := now.Add(-s.policy.Window)
+		kept := s.restarts[:0]
+		for _, restart := range s.restarts {
+			if restart.After(limit) {
+				kept = append(kept, restart)
+			}
+		}
+		s.restarts = kept
+		n = len(kept)
+	}
+	if s.policy.MaxRestarts > 0 && n >= s.policy.MaxRestarts {
+		return decisionGiveUp, 0
+	}
+	if s.policy.Window > 0 {
+		s.restarts = append(s.restarts, now)
+	}
+	s.total++
+	return decisionRestart, s.backoff(n + 1)
+}
+
+// backoff calculates the exponential backoff for the n-th restart.
+func (s *supervisor) backoff(n int) time.Duration {
+	backoff := s.policy.Backoff
+	if backoff <= 0 {
+		return 0
+	}
+	for i := 1; i < n; i++ {
+		if s.policy.MaxBackoff > 0 && backoff >= s.policy.MaxBackoff {
+			break
+		}
+		if backoff > backoff<<1 {
+			// Overflow.
+			break
+		}
+		backoff <<= 1
+	}
+	if s.policy.MaxBackoff > 0 && backoff > s.policy.MaxBackoff {
+		backoff = s.policy.MaxBackoff
+	}
+	return backoff
+}
+
+// EOF
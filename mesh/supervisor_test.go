@@ -0,0 +1,121 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSupervisorStrategies verifies the decisions of the different
+// restart strategies.
+func TestSupervisorStrategies(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	now := time.Now()
+	failure := errors.New("ouch")
+
+	s := newSupervisor(RestartPolicy{Strategy: RestartNever})
+	d, _ := s.next(failure, now)
+	assert.Equal(d, decisionStop)
+
+	s = newSupervisor(RestartPolicy{Strategy: RestartOnError})
+	d, _ = s.next(nil, now)
+	assert.Equal(d, decisionStop)
+	d, _ = s.next(failure, now)
+	assert.Equal(d, decisionRestart)
+
+	s = newSupervisor(RestartPolicy{Strategy: RestartAlways})
+	d, _ = s.next(nil, now)
+	assert.Equal(d, decisionRestart)
+	d, _ = s.next(failure, now)
+	assert.Equal(d, decisionRestart)
+	assert.Equal(s.total, 2)
+}
+
+// TestSupervisorLimit verifies the giving up after too many
+// restarts inside the window.
+func TestSupervisorLimit(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	now := time.Now()
+	failure := errors.New("ouch")
+	s := newSupervisor(RestartPolicy{
+		Strategy:    RestartOnError,
+		MaxRestarts: 2,
+		Window:      time.Minute,
+	})
+
+	d, _ := s.next(failure, now)
+	assert.Equal(d, decisionRestart)
+	d, _ = s.next(failure, now.Add(time.Second))
+	assert.Equal(d, decisionRestart)
+	d, _ = s.next(failure, now.Add(2*time.Second))
+	assert.Equal(d, decisionGiveUp)
+
+	// Older restarts leave the window.
+	d, _ = s.next(failure, now.Add(90*time.Second))
+	assert.Equal(d, decisionRestart)
+}
+
+// TestSupervisorNoWindow verifies the limit without a window, only
+// counting the restarts.
+func TestSupervisorNoWindow(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	now := time.Now()
+	failure := errors.New("ouch")
+	s := newSupervisor(RestartPolicy{
+		Strategy:    RestartOnError,
+		MaxRestarts: 3,
+	})
+
+	for i := 0; i < 3; i++ {
+		d, _ := s.next(failure, now.Add(time.Duration(i)*time.Hour))
+		assert.Equal(d, decisionRestart)
+	}
+	d, _ := s.next(failure, now.Add(24*time.Hour))
+	assert.Equal(d, decisionGiveUp)
+	assert.Equal(s.total, 3)
+	assert.Length(s.restarts, 0)
+}
+
+// TestSupervisorBackoff verifies the exponential backoff.
+func TestSupervisorBackoff(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	now := time.Now()
+	failure := errors.New("ouch")
+	s := newSupervisor(RestartPolicy{
+		Strategy:   RestartOnError,
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	})
+	backoffs := []time.Duration{}
+	for i := 0; i < 5; i++ {
+		_, backoff := s.next(failure, now)
+		backoffs = append(backoffs, backoff)
+	}
+
+	assert.Equal(backoffs, []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	})
+}
+
+// EOF
@@ -102,7 +102,7 @@ type TestbedTester func(tbe *TestbedEvaluator)
 type testbedMesh struct{}
 
 // Go implements Mesh and always returns an error.
-func (tbm testbedMesh) Go(name string, b Behavior) error {
+func (tbm testbedMesh) Go(name string, b Behavior, options ...CellOption) error {
 	return fmt.Errorf("cell name '%s' already used", name)
 }
 
@@ -111,11 +111,31 @@ func (tbm testbedMesh) Subscribe(emitterName, receptorName string) error {
 	return fmt.Errorf("emitter cell '%s' does not exist", emitterName)
 }
 
+// SubscribeTopics implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) SubscribeTopics(emitterName, receptorName string, patterns ...string) error {
+	return fmt.Errorf("emitter cell '%s' does not exist", emitterName)
+}
+
 // Unsubscribe implements mesh.Mesh and always returns an error.
 func (tbm testbedMesh) Unsubscribe(emitterName, receptorName string) error {
 	return fmt.Errorf("emitter cell '%s' does not exist", emitterName)
 }
 
+// SubscriptionTopics implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) SubscriptionTopics(emitterName, receptorName string) ([]string, error) {
+	return nil, fmt.Errorf("emitter cell '%s' does not exist", emitterName)
+}
+
+// Stop implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Stop(name string) error {
+	return fmt.Errorf("cell '%s' does not exist", name)
+}
+
+// Shutdown implements mesh.Mesh and does nothing.
+func (tbm testbedMesh) Shutdown(ctx context.Context) error {
+	return nil
+}
+
 // Emit implements mesh.Mesh and always returns an error.
 func (tbm testbedMesh) Emit(name, topic string, payloads ...interface{}) error {
 	evt, err := NewEvent(topic, payloads...)
@@ -130,11 +150,51 @@ func (tbm testbedMesh) EmitEvent(name string, evt *Event) error {
 	return fmt.Errorf("cell '%s' does not exist", name)
 }
 
+// Request implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Request(ctx context.Context, name, topic string, payloads ...interface{}) (*Event, error) {
+	return nil, fmt.Errorf("cell '%s' does not exist", name)
+}
+
 // Emitter implements mesh.Mesh and always returns an error.
 func (tbm testbedMesh) Emitter(name string) (Emitter, error) {
 	return nil, fmt.Errorf("cell '%s' does not exist", name)
 }
 
+// Cells implements mesh.Mesh and always returns no names.
+func (tbm testbedMesh) Cells() []string {
+	return nil
+}
+
+// CellInfo implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) CellInfo(name string) (CellInfo, error) {
+	return CellInfo{}, fmt.Errorf("cell '%s' does not exist", name)
+}
+
+// Subscribers implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Subscribers(name string) ([]string, error) {
+	return nil, fmt.Errorf("cell '%s' does not exist", name)
+}
+
+// Subscriptions implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Subscriptions(name string) ([]string, error) {
+	return nil, fmt.Errorf("cell '%s' does not exist", name)
+}
+
+// Metrics implements mesh.Mesh and always returns no metrics.
+func (tbm testbedMesh) Metrics() []CellMetrics {
+	return nil
+}
+
+// Snapshot implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Snapshot() error {
+	return errors.New("no snapshot store configured")
+}
+
+// Restore implements mesh.Mesh and always returns an error.
+func (tbm testbedMesh) Restore() error {
+	return errors.New("no snapshot store configured")
+}
+
 //--------------------
 // TESTBED CELL
 //--------------------
@@ -174,6 +234,16 @@ func (tbc *testbedCell) Mesh() Mesh {
 	return testbedMesh{}
 }
 
+// Clock implements mesh.Cell.
+func (tbc *testbedCell) Clock() Clock {
+	return tbc.tb.cfg.clock
+}
+
+// Logger implements mesh.Cell.
+func (tbc *testbedCell) Logger() Logger {
+	return withTags(tbc.tb.cfg.logger, "cell", tbc.Name(), "behavior", fmt.Sprintf("%T", tbc.behavior))
+}
+
 // Pull implements mesh.Receptor.
 func (tbc *testbedCell) Pull() <-chan *Event {
 	return tbc.inc
@@ -181,7 +251,7 @@ func (tbc *testbedCell) Pull() <-chan *Event {
 
 // Emit implements mesh.Emitter.
 func (tbc *testbedCell) Emit(topic string, payloads ...interface{}) error {
-	evt, err := NewEvent(topic, payloads...)
+	evt, err := tbc.tb.newEvent(topic, payloads...)
 	if err != nil {
 		return err
 	}
@@ -190,7 +260,7 @@ func (tbc *testbedCell) Emit(topic string, payloads ...interface{}) error {
 
 // EmitEvent implements mesh.Emitter and evaluates the event.
 func (tbc *testbedCell) EmitEvent(evt *Event) error {
-	evt.appendEmitter(tbc.Name())
+	evt = evt.withEmitter(tbc.Name())
 	tbc.tb.evaluator.Push(evt)
 	return nil
 }
@@ -242,7 +312,7 @@ func newTestbedEmitter(tb *Testbed) *testbedEmitter {
 
 // Emit creates an event and sends it to the behavior.
 func (tbe *testbedEmitter) Emit(topic string, payloads ...interface{}) error {
-	evt, err := NewEvent(topic, payloads...)
+	evt, err := tbe.tb.newEvent(topic, payloads...)
 	if err != nil {
 		return err
 	}
@@ -261,15 +331,20 @@ func (tbe *testbedEmitter) EmitEvent(evt *Event) error {
 
 // Testbed provides a simple environment for the testing of individual behaviors.
 // So retrieving the Mesh by the Cell is possible, but using its methods leads to
-// errors. Integration tests have to be done differently.
+// errors. Integration tests of multiple cells use the IntegrationTestbed.
 //
 // A tester function given when the testbed is started allows to evaluate the
 // events emitted by the behavior. As long as the tests aren't done the function
 // has to return false. Once returning true for the final tested event
 // Testbed.Wait() gets a signal. Otherwise a timeout will be returned to show
 // an internal error.
+//
+// Mesh options like WithClock() or WithDefaultCodec() configure the
+// testbed like a mesh. So time-aware behaviors can be tested with a
+// ManualClock advanced by the testbed runner.
 type Testbed struct {
 	ctx        context.Context
+	cfg        *meshConfig
 	cancel     func()
 	evaluator  *TestbedEvaluator
 	test       TestbedTester
@@ -281,10 +356,11 @@ type Testbed struct {
 
 // NewTestbed starts a test cell with the given behavior. The tester function
 // will be called for each event emitted by the behavior.
-func NewTestbed(behavior Behavior, tester TestbedTester) *Testbed {
+func NewTestbed(behavior Behavior, tester TestbedTester, options ...MeshOption) *Testbed {
 	ctx, cancel := context.WithCancel(context.Background())
 	tb := &Testbed{
 		ctx:        ctx,
+		cfg:        newMeshConfig(options...),
 		cancel:     cancel,
 		test:       tester,
 		succeededc: make(chan struct{}, 1),
@@ -312,6 +388,13 @@ func (tb *Testbed) Go(run TestbedRunner, timeout time.Duration) error {
 	return tb.wait(timeout)
 }
 
+// newEvent creates an event using the codec and the clock of
+// the testbed.
+func (tb *Testbed) newEvent(topic string, payloads ...interface{}) (*Event, error) {
+	payloads = append([]interface{}{WithCodec(tb.cfg.codec), WithTimestamp(tb.cfg.clock.Now())}, payloads...)
+	return NewEvent(topic, payloads...)
+}
+
 // wait waits until a test end or error has been signalled or a
 // timeout happened.
 func (tb *Testbed) wait(timeout time.Duration) error {
@@ -0,0 +1,103 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+//--------------------
+// TOPIC PATTERNS
+//--------------------
+
+// ValidateTopicPattern checks if the pattern can be used for
+// matching topics.
+func ValidateTopicPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty topic pattern")
+	}
+	for _, segment := range strings.Split(pattern, ".") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid topic pattern '%s': %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ValidateTopicPatterns checks if all patterns can be used for
+// matching topics.
+func ValidateTopicPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if err := ValidateTopicPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchTopic checks if the topic matches the pattern. Topics and
+// patterns are divided into segments by dots. Inside a pattern
+// segment "*" matches exactly one topic segment and "**" any number
+// of segments, including none. All other segments are matched like
+// path.Match() does, so "sensor.*.temp" matches "sensor.kitchen.temp"
+// and "sensor.k?tchen.t*" matches it too. A pattern without any
+// wildcards only matches the same topic.
+func MatchTopic(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	return matchSegments(strings.Split(pattern, "."), strings.Split(topic, "."))
+}
+
+// matchSegments recursively matches the pattern segments against
+// the topic segments.
+func matchSegments(patterns, topics []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			rest := patterns[1:]
+			for i := 0; i <= len(topics); i++ {
+				if matchSegments(rest, topics[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(topics) == 0 {
+			return false
+		}
+		ok, err := path.Match(patterns[0], topics[0])
+		if err != nil || !ok {
+			return false
+		}
+		patterns = patterns[1:]
+		topics = topics[1:]
+	}
+	return len(topics) == 0
+}
+
+// MatchTopics checks if the topic matches one of the patterns. No
+// patterns match all topics.
+func MatchTopics(patterns []string, topic string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// EOF
@@ -0,0 +1,73 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestMatchTopic verifies the matching of topics with patterns.
+func TestMatchTopic(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	tests := []struct {
+		pattern string
+		topic   string
+		matches bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"counters!", "counters!", true},
+		{"sensor.*.temp", "sensor.kitchen.temp", true},
+		{"sensor.*.temp", "sensor.kitchen.humidity", false},
+		{"sensor.*.temp", "sensor.house.kitchen.temp", false},
+		{"sensor.**.temp", "sensor.house.kitchen.temp", true},
+		{"sensor.**.temp", "sensor.temp", true},
+		{"sensor.**", "sensor.house.kitchen.temp", true},
+		{"sensor.**", "sensors", false},
+		{"**", "anything.at.all", true},
+		{"sensor.k?tchen.t*", "sensor.kitchen.temp", true},
+		{"sensor.[a-k]*.temp", "sensor.living.temp", false},
+		{"sensor.*", "sensor", false},
+	}
+	for _, test := range tests {
+		assert.Equal(mesh.MatchTopic(test.pattern, test.topic), test.matches, test.pattern+" / "+test.topic)
+	}
+
+	assert.NoError(mesh.ValidateTopicPattern("sensor.*.temp"))
+	assert.ErrorContains(mesh.ValidateTopicPattern(""), "empty topic pattern")
+	assert.ErrorContains(mesh.ValidateTopicPattern("sensor.[a-.temp"), "invalid topic pattern")
+}
+
+// TestMatchTopics verifies the matching of topics with multiple patterns.
+func TestMatchTopics(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	patterns := []string{"alarm.**", "info"}
+
+	assert.True(mesh.MatchTopics(patterns, "alarm.fire"))
+	assert.True(mesh.MatchTopics(patterns, "info"))
+	assert.False(mesh.MatchTopics(patterns, "warning"))
+	assert.True(mesh.MatchTopics(nil, "anything"))
+
+	assert.NoError(mesh.ValidateTopicPatterns(patterns))
+	assert.NoError(mesh.ValidateTopicPatterns(nil))
+	assert.ErrorContains(mesh.ValidateTopicPatterns([]string{"info", ""}), "empty topic pattern")
+}
+
+// EOF
@@ -0,0 +1,306 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------
+// SPAN CONTEXT
+//--------------------
+
+// SpanContext identifies a span inside a trace. It is propagated with
+// the events. The IDs are hex encoded like in W3C Trace Context and
+// OpenTelemetry, 32 characters for the trace and 16 for the span.
+// Sampled carries the sampling decision of the trace, so that tracers
+// can follow the decision of the emitter.
+type SpanContext struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+	Sampled bool   `json:"sampled,omitempty"`
+}
+
+// IsValid checks if the span context contains valid IDs.
+func (sc SpanContext) IsValid() bool {
+	return isHexID(sc.TraceID, 32) && isHexID(sc.SpanID, 16)
+}
+
+// Traceparent returns the span context as W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value, e.g. to
+// continue a trace coming in via HTTP with WithSpanContext().
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent '%s'", traceparent)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent '%s'", traceparent)
+	}
+	sc := SpanContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: flags[0]&0x01 != 0,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent '%s'", traceparent)
+	}
+	return sc, nil
+}
+
+// isHexID checks if the ID is hex encoded, has the length, and is
+// not only zeros.
+func isHexID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+//--------------------
+// TRACER
+//--------------------
+
+// SpanKind tells which part of the event flow a span covers.
+type SpanKind int
+
+// Span kinds.
+const (
+	// SpanEmit covers the emitting of an event by a cell or the
+	// mesh to its subscribers.
+	SpanEmit SpanKind = iota
+
+	// SpanProcess covers the processing of an event by the behavior
+	// of a cell, from the handover until the behavior pulls again.
+	SpanProcess
+)
+
+// String implements fmt.Stringer.
+func (k SpanKind) String() string {
+	switch k {
+	case SpanEmit:
+		return "emit"
+	case SpanProcess:
+		return "process"
+	}
+	return fmt.Sprintf("SpanKind(%d)", int(k))
+}
+
+// Span attribute keys set by the cells.
+const (
+	SpanAttrCell     = "cell"
+	SpanAttrEventID  = "event.id"
+	SpanAttrTopic    = "event.topic"
+	SpanAttrEmitters = "event.emitters"
+)
+
+// Span is a timed step of the event flow.
+type Span interface {
+	// SpanContext returns the context of the span which is
+	// propagated with the event.
+	SpanContext() SpanContext
+
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key, value string)
+
+	// SetError marks the span as failed.
+	SetError(err error)
+
+	// End finishes the span.
+	End()
+}
+
+// Tracer starts the spans for the emitting and processing of events.
+// It is set for a mesh with WithTracer(). The package tracing contains
+// an adapter for OpenTelemetry.
+type Tracer interface {
+	// Start starts a new span. An invalid parent starts a new trace.
+	Start(name string, kind SpanKind, parent SpanContext) Span
+}
+
+// startSpan starts a span for the event and returns a copy of the
+// event carrying the context of the span.
+func startSpan(tracer Tracer, kind SpanKind, cell string, evt *Event) (*Event, Span) {
+	span := tracer.Start(kind.String()+" "+evt.topic, kind, evt.spanContext)
+	span.SetAttribute(SpanAttrCell, cell)
+	span.SetAttribute(SpanAttrEventID, evt.id)
+	span.SetAttribute(SpanAttrTopic, evt.topic)
+	span.SetAttribute(SpanAttrEmitters, evt.Emitters())
+	traced := *evt
+	traced.spanContext = span.SpanContext()
+	return &traced, span
+}
+
+// failSpan marks the span as failed if there is one.
+func failSpan(span Span, err error) {
+	if span != nil {
+		span.SetError(err)
+	}
+}
+
+//--------------------
+// MEMORY TRACER
+//--------------------
+
+// spanCounter makes the span IDs inside this process unique.
+var spanCounter uint64
+
+// newSpanID creates a new unique span ID.
+func newSpanID() string {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, binary.BigEndian.Uint64(idPrefix)^atomic.AddUint64(&spanCounter, 1))
+	return hex.EncodeToString(id)
+}
+
+// SpanData contains a span recorded by the MemoryTracer.
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanContext
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      string
+}
+
+// MemoryTracer records the spans in memory, e.g. for tests or for
+// debugging.
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewMemoryTracer creates a new tracer recording the spans in memory.
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+// Start implements Tracer.
+func (mt *MemoryTracer) Start(name string, kind SpanKind, parent SpanContext) Span {
+	sc := SpanContext{
+		TraceID: parent.TraceID,
+		SpanID:  newSpanID(),
+		Sampled: parent.Sampled,
+	}
+	if !parent.IsValid() {
+		sc.TraceID = newEventID()
+		sc.Sampled = true
+		parent = SpanContext{}
+	}
+	return &memorySpan{
+		tracer: mt,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Context:    sc,
+			Parent:     parent,
+			Start:      time.Now(),
+			Attributes: make(map[string]string),
+		},
+	}
+}
+
+// Spans returns the ended spans in the order they ended.
+func (mt *MemoryTracer) Spans() []SpanData {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return append([]SpanData(nil), mt.spans...)
+}
+
+// Trace returns the ended spans of a trace sorted by their start.
+func (mt *MemoryTracer) Trace(traceID string) []SpanData {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	var spans []SpanData
+	for _, span := range mt.spans {
+		if span.Context.TraceID == traceID {
+			spans = append(spans, span)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans
+}
+
+// Reset removes all recorded spans.
+func (mt *MemoryTracer) Reset() {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.spans = nil
+}
+
+// memorySpan is a span of the MemoryTracer.
+type memorySpan struct {
+	mu     sync.Mutex
+	tracer *MemoryTracer
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext implements Span.
+func (ms *memorySpan) SpanContext() SpanContext {
+	return ms.data.Context
+}
+
+// SetAttribute implements Span.
+func (ms *memorySpan) SetAttribute(key, value string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data.Attributes[key] = value
+}
+
+// SetError implements Span.
+func (ms *memorySpan) SetError(err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data.Error = err.Error()
+}
+
+// End implements Span.
+func (ms *memorySpan) End() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.ended {
+		return
+	}
+	ms.ended = true
+	ms.data.End = time.Now()
+	data := ms.data
+	data.Attributes = make(map[string]string, len(ms.data.Attributes))
+	for key, value := range ms.data.Attributes {
+		data.Attributes[key] = value
+	}
+	ms.tracer.mu.Lock()
+	defer ms.tracer.mu.Unlock()
+	ms.tracer.spans = append(ms.tracer.spans, data)
+}
+
+// EOF
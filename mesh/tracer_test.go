@@ -0,0 +1,151 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSpanContext verifies the W3C traceparent format and the
+// propagation of span contexts in JSON.
+func TestSpanContext(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	sc, err := mesh.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(err)
+	assert.True(sc.IsValid())
+	assert.Equal(sc.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(sc.SpanID, "00f067aa0ba902b7")
+	assert.True(sc.Sampled)
+	assert.Equal(sc.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	unsampled, err := mesh.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.NoError(err)
+	assert.False(unsampled.Sampled)
+	assert.Equal(unsampled.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+	} {
+		_, err = mesh.ParseTraceparent(invalid)
+		assert.ErrorContains(err, "invalid traceparent")
+	}
+	assert.False(mesh.SpanContext{}.IsValid())
+
+	// JSON contains the span context only if set.
+	evt, err := mesh.NewEvent("test", mesh.WithSpanContext(sc))
+	assert.NoError(err)
+	data, err := json.Marshal(evt)
+	assert.NoError(err)
+	assert.Contains(`"spanContext":{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","sampled":true}`, string(data))
+	var unmarshalled mesh.Event
+	assert.NoError(json.Unmarshal(data, &unmarshalled))
+	assert.Equal(unmarshalled.SpanContext(), sc)
+
+	evt, err = mesh.NewEvent("test")
+	assert.NoError(err)
+	data, err = json.Marshal(evt)
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(data, &unmarshalled))
+	assert.False(unmarshalled.SpanContext().IsValid())
+}
+
+// TestTracing verifies the spans of the emitting and processing of events.
+func TestTracing(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracer := mesh.NewMemoryTracer()
+	deriveFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if evt.Topic() == "fail" {
+					return errors.New("ouch")
+				}
+				out.Emit("derived")
+			}
+		}
+	}
+	msh := mesh.New(ctx, mesh.WithTracer(tracer))
+	assert.NoError(msh.Go("forward", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Go("derive", mesh.BehaviorFunc(deriveFunc)))
+	assert.NoError(msh.Subscribe("forward", "derive"))
+
+	// Emitted event continues the trace of the passed span context.
+	parent := mesh.SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}
+	evt, err := mesh.NewEvent("a", mesh.WithSpanContext(parent))
+	assert.NoError(err)
+	assert.NoError(msh.EmitEvent("forward", evt))
+	assert.Retry(func() bool {
+		return len(tracer.Trace(parent.TraceID)) == 5
+	}, 100, 10*time.Millisecond)
+
+	spans := map[string]mesh.SpanData{}
+	for _, span := range tracer.Trace(parent.TraceID) {
+		spans[span.Name+"@"+span.Attributes[mesh.SpanAttrCell]] = span
+		assert.True(!span.End.Before(span.Start))
+		assert.Equal(span.Error, "")
+	}
+	assert.Equal(spans["emit a@/"].Parent, parent)
+	assert.Equal(spans["emit a@/"].Kind, mesh.SpanEmit)
+	assert.Equal(spans["process a@forward"].Parent, spans["emit a@/"].Context)
+	assert.Equal(spans["process a@forward"].Kind, mesh.SpanProcess)
+	assert.Equal(spans["emit a@forward"].Parent, spans["process a@forward"].Context)
+	assert.Equal(spans["emit a@forward"].Attributes[mesh.SpanAttrEmitters], "/forward")
+	assert.Equal(spans["process a@derive"].Parent, spans["emit a@forward"].Context)
+	assert.Equal(spans["emit derived@derive"].Parent, spans["process a@derive"].Context)
+	assert.Equal(spans["emit derived@derive"].Attributes[mesh.SpanAttrTopic], "derived")
+
+	// Events without span context start new traces, errors of
+	// the behavior mark the processing span.
+	tracer.Reset()
+	assert.NoError(msh.Emit("forward", "fail"))
+	var process mesh.SpanData
+	assert.Retry(func() bool {
+		for _, span := range tracer.Spans() {
+			if span.Name == "process fail" && span.Attributes[mesh.SpanAttrCell] == "derive" {
+				process = span
+				return true
+			}
+		}
+		return false
+	}, 100, 10*time.Millisecond)
+	assert.Equal(process.Error, "ouch")
+	assert.Different(process.Context.TraceID, parent.TraceID)
+	trace := tracer.Trace(process.Context.TraceID)
+	assert.Equal(trace[0].Name, "emit fail")
+	assert.False(trace[0].Parent.IsValid())
+
+	msh.Shutdown(ctx)
+}
+
+// EOF
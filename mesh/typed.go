@@ -0,0 +1,35 @@
+// Tideland Go Cells - Mesh
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// TYPED EVENTS
+//--------------------
+
+// NewTypedEvent creates a new Event based on a topic and exactly one
+// payload of type T. Options like WithCodec() can be added.
+func NewTypedEvent[T any](topic string, payload T, options ...EventOption) (*Event, error) {
+	payloads := make([]interface{}, 0, len(options)+1)
+	for _, option := range options {
+		payloads = append(payloads, option)
+	}
+	payloads = append(payloads, payload)
+	return NewEvent(topic, payloads...)
+}
+
+// PayloadAs returns the payload of the event unmarshalled into a
+// value of type T.
+func PayloadAs[T any](evt *Event) (T, error) {
+	var payload T
+	if err := evt.Payload(&payload); err != nil {
+		return payload, err
+	}
+	return payload, nil
+}
+
+// EOF
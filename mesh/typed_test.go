@@ -0,0 +1,62 @@
+// Tideland Go Cells - Mesh - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package mesh_test // import "tideland.dev/go/cells/mesh"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTypedEvent verifies the creation of typed events and the typed
+// access to payloads.
+func TestTypedEvent(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	type reading struct {
+		Sensor string
+		Value  float64
+	}
+
+	evt, err := mesh.NewTypedEvent("reading", reading{"kitchen", 21.5}, mesh.WithHeader("unit", "celsius"))
+	assert.NoError(err)
+	unit, _ := evt.Header("unit")
+	assert.Equal(unit, "celsius")
+	r, err := mesh.PayloadAs[reading](evt)
+	assert.NoError(err)
+	assert.Equal(r, reading{"kitchen", 21.5})
+
+	// Mismatching types.
+	_, err = mesh.PayloadAs[int](evt)
+	assert.ErrorContains(err, "cannont unmarshal payload")
+
+	// Missing payload.
+	evt, err = mesh.NewEvent("empty")
+	assert.NoError(err)
+	_, err = mesh.PayloadAs[string](evt)
+	assert.ErrorContains(err, "contains no payload")
+
+	// Reference codec.
+	in := &reading{"garden", 12.0}
+	evt, err = mesh.NewTypedEvent("reading", in, mesh.WithCodec(mesh.NewReferenceCodec(nil)))
+	assert.NoError(err)
+	out, err := mesh.PayloadAs[*reading](evt)
+	assert.NoError(err)
+	assert.True(out == in)
+}
+
+// EOF
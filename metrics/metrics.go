@@ -0,0 +1,154 @@
+// Tideland Go Cells - Metrics
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package metrics exposes the metrics of the cells of a mesh in the
+// Prometheus text format. The handler can be registered at any HTTP
+// server, e.g.
+//
+//	http.Handle("/metrics", metrics.NewHandler(msh))
+//
+// The metrics are labeled with the names of the cells. Counters are
+// cells_events_received_total, cells_events_emitted_total,
+// cells_events_dropped_total, cells_events_undelivered_total,
+// cells_errors_total, and cells_restarts_total, gauges are
+// cells_queue_length and cells_queue_capacity. The histograms cells_processing_seconds and
+// cells_emit_wait_seconds contain the processing times of the
+// behaviors and the waiting times of the emitters to the cells.
+package metrics // import "tideland.dev/go/cells/metrics"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//--------------------
+// HANDLER
+//--------------------
+
+// handler serves the metrics of a mesh.
+type handler struct {
+	msh mesh.Mesh
+}
+
+// NewHandler creates a HTTP handler serving the metrics of the mesh
+// in the Prometheus text format.
+func NewHandler(msh mesh.Mesh) http.Handler {
+	return &handler{
+		msh: msh,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := Write(w, h.msh.Metrics()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+//--------------------
+// WRITER
+//--------------------
+
+// counter describes one counter or gauge per cell.
+type counter struct {
+	name  string
+	kind  string
+	help  string
+	value func(cm mesh.CellMetrics) float64
+}
+
+// counters contains all counters and gauges in their order.
+var counters = []counter{
+	{"cells_events_received_total", "counter", "Number of events received by the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Received) }},
+	{"cells_events_emitted_total", "counter", "Number of events emitted by the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Emitted) }},
+	{"cells_events_dropped_total", "counter", "Number of events dropped by the queue of the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Dropped) }},
+	{"cells_events_undelivered_total", "counter", "Number of emitted events which could not be delivered to a subscriber.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Undelivered) }},
+	{"cells_errors_total", "counter", "Number of errors of the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Errors) }},
+	{"cells_restarts_total", "counter", "Number of restarts of the behavior of the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.Restarts) }},
+	{"cells_queue_length", "gauge", "Number of events queued for the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.QueueLen) }},
+	{"cells_queue_capacity", "gauge", "Capacity of the queue of the cell.",
+		func(cm mesh.CellMetrics) float64 { return float64(cm.QueueCap) }},
+}
+
+// histogram describes one histogram per cell.
+type histogram struct {
+	name  string
+	help  string
+	value func(cm mesh.CellMetrics) mesh.Histogram
+}
+
+// histograms contains all histograms in their order.
+var histograms = []histogram{
+	{"cells_processing_seconds", "Processing time of the events by the behavior of the cell.",
+		func(cm mesh.CellMetrics) mesh.Histogram { return cm.Processing }},
+	{"cells_emit_wait_seconds", "Time emitters waited for space in the queue of the cell.",
+		func(cm mesh.CellMetrics) mesh.Histogram { return cm.EmitWait }},
+}
+
+// Write writes the metrics of the cells in the Prometheus text format.
+func Write(w io.Writer, metrics []mesh.CellMetrics) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind)
+		for _, cm := range metrics {
+			fmt.Fprintf(bw, "%s{cell=\"%s\"} %s\n", c.name, escape(cm.Name), formatFloat(c.value(cm)))
+		}
+	}
+	for _, h := range histograms {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for _, cm := range metrics {
+			hg := h.value(cm)
+			cell := escape(cm.Name)
+			cumulative := uint64(0)
+			for i, bound := range hg.Bounds {
+				cumulative += hg.Counts[i]
+				fmt.Fprintf(bw, "%s_bucket{cell=\"%s\",le=\"%s\"} %d\n", h.name, cell, formatFloat(bound.Seconds()), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket{cell=\"%s\",le=\"+Inf\"} %d\n", h.name, cell, hg.Count)
+			fmt.Fprintf(bw, "%s_sum{cell=\"%s\"} %s\n", h.name, cell, formatFloat(hg.Sum.Seconds()))
+			fmt.Fprintf(bw, "%s_count{cell=\"%s\"} %d\n", h.name, cell, hg.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// escape escapes a label value.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a value in the shortest representation.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// EOF
@@ -0,0 +1,105 @@
+// Tideland Go Cells - Metrics - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package metrics_test // import "tideland.dev/go/cells/metrics"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/metrics"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestWrite verifies the writing of metrics in the Prometheus text format.
+func TestWrite(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	processing := mesh.Histogram{
+		Bounds: []time.Duration{time.Millisecond, time.Second},
+		Counts: []uint64{2, 1, 1},
+		Count:  4,
+		Sum:    2500 * time.Millisecond,
+	}
+	var buf bytes.Buffer
+	err := metrics.Write(&buf, []mesh.CellMetrics{{
+		Name:       `a "quoted" cell`,
+		Received:   10,
+		Emitted:    7,
+		Dropped:    1,
+		QueueLen:   2,
+		QueueCap:   64,
+		Processing: processing,
+		EmitWait:   mesh.Histogram{Counts: []uint64{0}},
+	}})
+	assert.NoError(err)
+	out := buf.String()
+	for _, expected := range []string{
+		"# TYPE cells_events_received_total counter\n",
+		`cells_events_received_total{cell="a \"quoted\" cell"} 10` + "\n",
+		`cells_events_emitted_total{cell="a \"quoted\" cell"} 7` + "\n",
+		`cells_events_dropped_total{cell="a \"quoted\" cell"} 1` + "\n",
+		`cells_errors_total{cell="a \"quoted\" cell"} 0` + "\n",
+		"# TYPE cells_queue_length gauge\n",
+		`cells_queue_capacity{cell="a \"quoted\" cell"} 64` + "\n",
+		"# TYPE cells_processing_seconds histogram\n",
+		`cells_processing_seconds_bucket{cell="a \"quoted\" cell",le="0.001"} 2` + "\n",
+		`cells_processing_seconds_bucket{cell="a \"quoted\" cell",le="1"} 3` + "\n",
+		`cells_processing_seconds_bucket{cell="a \"quoted\" cell",le="+Inf"} 4` + "\n",
+		`cells_processing_seconds_sum{cell="a \"quoted\" cell"} 2.5` + "\n",
+		`cells_processing_seconds_count{cell="a \"quoted\" cell"} 4` + "\n",
+		`cells_emit_wait_seconds_count{cell="a \"quoted\" cell"} 0` + "\n",
+	} {
+		assert.Contains(expected, out)
+	}
+}
+
+// TestHandler verifies serving the metrics of a mesh.
+func TestHandler(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("echo", mesh.NewRequestBehavior(func(cell mesh.Cell, evt *mesh.Event, out mesh.Emitter) error {
+		return out.EmitEvent(evt)
+	})))
+	assert.NoError(msh.Emit("echo", "a"))
+	assert.NoError(msh.Emit("echo", "b"))
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("echo")
+		return err == nil && info.Emitted == 2
+	}, 100, 10*time.Millisecond)
+
+	srv := httptest.NewServer(metrics.NewHandler(msh))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	assert.NoError(err)
+	defer resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusOK)
+	assert.Equal(resp.Header.Get("Content-Type"), metrics.ContentType)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Contains(`cells_events_received_total{cell="echo"} 2`, string(body))
+	assert.Contains(`cells_events_emitted_total{cell="echo"} 2`, string(body))
+	assert.Contains(`cells_processing_seconds_count{cell="echo"} `, string(body))
+}
+
+// EOF
@@ -0,0 +1,252 @@
+// Tideland Go Cells - Recording
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package recording captures the events emitted by selected cells of a
+// mesh into a log and replays such logs into a mesh. There the events
+// are emitted to the subscribers of the recorded cells, so the cells
+// depending on them receive the same input again. The log contains
+// one record per line in JSON, each with the name of the recording cell
+// and the event including its timestamp and emitters path.
+//
+//	{"cell":"sensors","event":{"timestamp":"...","emitters":["/","sensors"],"topic":"temp","payload":21.5}}
+//
+// Recording is started with
+//
+//	rec := recording.NewRecorder(msh, file)
+//	err := rec.Record("sensors", "alarms")
+//
+// and the log is replayed, here accelerated by factor 10, with
+//
+//	err := recording.Replay(ctx, msh, file, recording.WithSpeed(10))
+//
+// So incidents can be reproduced locally and changes of behaviors can be
+// tested against real traffic.
+package recording // import "tideland.dev/go/cells/recording"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// RECORD
+//--------------------
+
+// Record is one entry of a log, the event emitted by a cell.
+type Record struct {
+	Cell  string      `json:"cell"`
+	Event *mesh.Event `json:"event"`
+}
+
+//--------------------
+// WRITER
+//--------------------
+
+// maxLineSize limits the size of one line of a log.
+const maxLineSize = 16 * 1024 * 1024
+
+// Writer writes records as JSON lines. It can be used concurrently.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriter creates a writer for records.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Write writes one record.
+func (w *Writer) Write(rec Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(rec); err != nil {
+		return fmt.Errorf("cannot write record: %v", err)
+	}
+	return nil
+}
+
+//--------------------
+// READER
+//--------------------
+
+// Reader reads records from JSON lines. Empty lines are skipped.
+// Lines containing only an event are read as records without cell.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader creates a reader for records.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	return &Reader{
+		scanner: scanner,
+	}
+}
+
+// Next returns the next record. At the end of the log it returns
+// io.EOF.
+func (r *Reader) Next() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return Record{}, fmt.Errorf("line %d: invalid record: %v", r.line, err)
+		}
+		if rec.Event == nil {
+			// Line contains a plain event.
+			rec.Cell = ""
+			rec.Event = &mesh.Event{}
+			if err := json.Unmarshal(data, rec.Event); err != nil {
+				return Record{}, fmt.Errorf("line %d: invalid event: %v", r.line, err)
+			}
+		}
+		if rec.Event.Topic() == "" {
+			return Record{}, fmt.Errorf("line %d: event has no topic", r.line)
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// Line returns the number of the line of the last read record.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// ReadAll reads all records of the log.
+func ReadAll(r io.Reader) ([]Record, error) {
+	var recs []Record
+	reader := NewReader(r)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+}
+
+//--------------------
+// RECORDER
+//--------------------
+
+// recordPrefix is the prefix of the names of the recording cells.
+const recordPrefix = "record:"
+
+// Recorder records the events emitted by cells of a mesh.
+type Recorder struct {
+	mu     sync.Mutex
+	msh    mesh.Mesh
+	writer *Writer
+	cells  map[string]string
+	err    error
+}
+
+// NewRecorder creates a recorder writing the records of the mesh
+// into the writer.
+func NewRecorder(msh mesh.Mesh, w io.Writer) *Recorder {
+	return &Recorder{
+		msh:    msh,
+		writer: NewWriter(w),
+		cells:  make(map[string]string),
+	}
+}
+
+// Record starts recording the events emitted by the named cells. For
+// each one a recording cell is subscribed to it.
+func (r *Recorder) Record(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if r.cells[name] != "" {
+			continue
+		}
+		recordName := recordPrefix + name
+		if err := r.msh.Go(recordName, mesh.BehaviorFunc(r.recordFunc(name))); err != nil {
+			return err
+		}
+		if err := r.msh.Subscribe(name, recordName); err != nil {
+			r.msh.Stop(recordName)
+			return err
+		}
+		r.cells[name] = recordName
+	}
+	return nil
+}
+
+// Stop stops recording the events of all cells after the already
+// received ones are written. It returns the first error which
+// happened during recording.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	cells := r.cells
+	r.cells = make(map[string]string)
+	r.mu.Unlock()
+	for _, recordName := range cells {
+		r.msh.Stop(recordName)
+	}
+	return r.Err()
+}
+
+// Err returns the first error which happened during recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// recordFunc returns the behavior function writing the events
+// emitted by the named cell.
+func (r *Recorder) recordFunc(name string) mesh.BehaviorFunc {
+	return func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		for {
+			select {
+			case <-cell.Context().Done():
+				return nil
+			case evt := <-in.Pull():
+				if err := r.writer.Write(Record{
+					Cell:  name,
+					Event: evt,
+				}); err != nil {
+					r.mu.Lock()
+					if r.err == nil {
+						r.err = err
+					}
+					r.mu.Unlock()
+					return err
+				}
+			}
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,324 @@
+// Tideland Go Cells - Recording - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package recording_test // import "tideland.dev/go/cells/recording"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/recording"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestWriterReader verifies writing and reading records.
+func TestWriterReader(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	var buf bytes.Buffer
+	w := recording.NewWriter(&buf)
+	for _, topic := range []string{"a", "b", "c"} {
+		evt, err := mesh.NewEvent(topic, topic)
+		assert.NoError(err)
+		assert.NoError(w.Write(recording.Record{Cell: "cell-" + topic, Event: evt}))
+	}
+	buf.WriteString("\n{\"topic\":\"d\",\"payload\":4}\n")
+
+	r := recording.NewReader(&buf)
+	for _, topic := range []string{"a", "b", "c"} {
+		rec, err := r.Next()
+		assert.NoError(err)
+		assert.Equal(rec.Cell, "cell-"+topic)
+		assert.Equal(rec.Event.Topic(), topic)
+		var payload string
+		assert.NoError(rec.Event.Payload(&payload))
+		assert.Equal(payload, topic)
+	}
+	rec, err := r.Next()
+	assert.NoError(err)
+	assert.Equal(rec.Cell, "")
+	assert.Equal(rec.Event.Topic(), "d")
+	assert.Equal(r.Line(), 5)
+	_, err = r.Next()
+	assert.Equal(err, io.EOF)
+
+	_, err = recording.ReadAll(strings.NewReader("{\"cell\":\"a\",\"event\":{\"topic\":\"a\"}}\n{broken\n"))
+	assert.ErrorContains(err, "line 2: invalid record")
+	_, err = recording.ReadAll(strings.NewReader("{\"cell\":\"a\"}\n"))
+	assert.ErrorContains(err, "line 1: event has no topic")
+}
+
+// TestRecorder verifies recording the events of cells of a mesh.
+func TestRecorder(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("input", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Go("output", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Subscribe("input", "output"))
+
+	buf := &syncBuffer{}
+	recorder := recording.NewRecorder(msh, buf)
+	assert.NoError(recorder.Record("input", "output"))
+	assert.ErrorContains(recorder.Record("dont-exist"), "emitter cell 'dont-exist' does not exist")
+
+	assert.NoError(msh.Emit("input", "a", 1))
+	assert.NoError(msh.Emit("input", "b", 2))
+	assert.Retry(func() bool {
+		return strings.Count(buf.String(), "\n") == 4
+	}, 100, 10*time.Millisecond)
+	assert.NoError(recorder.Stop())
+
+	recs, err := recording.ReadAll(strings.NewReader(buf.String()))
+	assert.NoError(err)
+	assert.Length(recs, 4)
+	paths := map[string][]string{}
+	for _, rec := range recs {
+		assert.False(rec.Event.Timestamp().IsZero())
+		paths[rec.Cell] = append(paths[rec.Cell], rec.Event.Topic()+"@"+rec.Event.Emitters())
+	}
+	assert.Equal(paths["input"], []string{"a@/input", "b@/input"})
+	assert.Equal(paths["output"], []string{"a@/input/output", "b@/input/output"})
+
+	assert.NoError(msh.Shutdown(context.Background()))
+}
+
+// TestReplay verifies replaying a log as fast as possible.
+func TestReplay(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	itb := mesh.NewIntegrationTestbed()
+	defer itb.Stop()
+	assert.NoError(itb.Go("a", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Go("b", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Capture("a", "b"))
+
+	log := writeLog(assert, time.Now(), time.Hour, "a", "b", "a", "")
+	err := recording.Replay(context.Background(), itb.Mesh(), bytes.NewReader(log), recording.WithSpeed(0))
+	assert.ErrorContains(err, "line 4: record has no cell and no target is set")
+	assert.NoError(itb.WaitForTopics("a", []string{"t0", "t2"}, time.Second))
+	assert.NoError(itb.WaitForTopics("b", []string{"t1"}, time.Second))
+
+	err = recording.Replay(context.Background(), itb.Mesh(), bytes.NewReader(log),
+		recording.WithSpeed(0), recording.WithTarget("b"))
+	assert.NoError(err)
+	assert.NoError(itb.WaitForTopics("b", []string{"t1", "t0", "t1", "t2", "t3"}, time.Second))
+
+	err = recording.Replay(context.Background(), itb.Mesh(), bytes.NewReader(log), recording.WithTarget("dont-exist"))
+	assert.ErrorContains(err, "line 1: cell 'dont-exist' does not exist")
+}
+
+// TestReplayMeshTopics verifies that recorded events emitted by the
+// mesh itself are skipped.
+func TestReplayMeshTopics(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	itb := mesh.NewIntegrationTestbed()
+	defer itb.Stop()
+	assert.NoError(itb.Go("b", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Capture("b"))
+
+	var buf bytes.Buffer
+	w := recording.NewWriter(&buf)
+	topics := []string{
+		mesh.TopicError, "value", mesh.TopicRestarted,
+		mesh.TopicGivenUp, mesh.TopicTerminated, "done",
+	}
+	for _, topic := range topics {
+		evt, err := mesh.NewEvent(topic)
+		assert.NoError(err)
+		assert.NoError(w.Write(recording.Record{Cell: "a", Event: evt}))
+	}
+	err := recording.Replay(context.Background(), itb.Mesh(), &buf,
+		recording.WithSpeed(0), recording.WithTarget("b"))
+	assert.NoError(err)
+	assert.NoError(itb.WaitForTopics("b", []string{"value", "done"}, time.Second))
+}
+
+// TestReplayStateful verifies that replayed events reach the subscribers
+// of the recorded cells and not the stateful cells themselves.
+func TestReplayStateful(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("input", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(msh.Go("sum", mesh.BehaviorFunc(sumFunc)))
+	assert.NoError(msh.Subscribe("input", "sum"))
+	buf := &syncBuffer{}
+	recorder := recording.NewRecorder(msh, buf)
+	assert.NoError(recorder.Record("input", "sum"))
+	for _, value := range []int{1, 2, 3} {
+		assert.NoError(msh.Emit("input", "value", value))
+	}
+	assert.Retry(func() bool {
+		return strings.Count(buf.String(), "\n") == 6
+	}, 100, 10*time.Millisecond)
+	assert.NoError(recorder.Stop())
+	assert.NoError(msh.Shutdown(context.Background()))
+
+	// Replay into a fresh mesh with the same topology.
+	itb := mesh.NewIntegrationTestbed()
+	defer itb.Stop()
+	assert.NoError(itb.Go("input", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Go("sum", mesh.BehaviorFunc(sumFunc)))
+	assert.NoError(itb.Subscribe("input", "sum"))
+	assert.NoError(itb.Capture("input", "sum"))
+	err := recording.Replay(context.Background(), itb.Mesh(), strings.NewReader(buf.String()), recording.WithSpeed(0))
+	assert.NoError(err)
+
+	// The sum gets the recorded values once and calculates the same
+	// totals, the recorded totals are passed to its subscribers.
+	assert.NoError(itb.WaitForTopics("sum", []string{"total", "total", "total", "total", "total", "total"}, time.Second))
+	sink, err := itb.Captured("sum")
+	assert.NoError(err)
+	var totals []int
+	assert.NoError(sink.Do(func(_ int, evt *mesh.Event) error {
+		var total int
+		assert.NoError(evt.Payload(&total))
+		totals = append(totals, total)
+		return nil
+	}))
+	sort.Ints(totals)
+	assert.Equal(totals, []int{1, 1, 3, 3, 6, 6})
+	info, err := itb.Mesh().CellInfo("sum")
+	assert.NoError(err)
+	assert.Equal(info.Processed, uint64(3))
+	info, err = itb.Mesh().CellInfo("input")
+	assert.NoError(err)
+	assert.Equal(info.Processed, uint64(0))
+}
+
+// TestReplayTiming verifies that replays keep the time between the
+// events according to the speed.
+func TestReplayTiming(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	itb := mesh.NewIntegrationTestbed()
+	defer itb.Stop()
+	assert.NoError(itb.Go("a", mesh.BehaviorFunc(forwardFunc)))
+	assert.NoError(itb.Capture("a"))
+
+	start := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	log := writeLog(assert, start, 10*time.Second, "a", "a", "a")
+	clock := mesh.NewManualClock(start)
+	done := make(chan error, 1)
+	go func() {
+		done <- recording.Replay(context.Background(), itb.Mesh(), bytes.NewReader(log),
+			recording.WithSpeed(2), recording.WithClock(clock))
+	}()
+
+	assert.NoError(itb.WaitForTopics("a", []string{"t0"}, time.Second))
+	clock.BlockUntil(1)
+	clock.Advance(4 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	topics, err := itb.Topics("a")
+	assert.NoError(err)
+	assert.Equal(topics, []string{"t0"})
+	clock.Advance(time.Second)
+	assert.NoError(itb.WaitForTopics("a", []string{"t0", "t1"}, time.Second))
+	clock.BlockUntil(1)
+	clock.Advance(5 * time.Second)
+	assert.NoError(itb.WaitForTopics("a", []string{"t0", "t1", "t2"}, time.Second))
+	assert.NoError(<-done)
+
+	// Cancelled replays stop waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- recording.Replay(ctx, itb.Mesh(), bytes.NewReader(log), recording.WithClock(clock))
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	assert.Equal(<-done, context.Canceled)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// syncBuffer is a buffer which can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the buffer content.
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// forwardFunc is a behavior function emitting all received events.
+func forwardFunc(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			out.EmitEvent(evt)
+		}
+	}
+}
+
+// sumFunc is a behavior function emitting the running total of the
+// received values.
+func sumFunc(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+	total := 0
+	for {
+		select {
+		case <-cell.Context().Done():
+			return nil
+		case evt := <-in.Pull():
+			if evt.Topic() != "value" {
+				continue
+			}
+			var value int
+			if err := evt.Payload(&value); err != nil {
+				return err
+			}
+			total += value
+			out.Emit("total", total)
+		}
+	}
+}
+
+// writeLog creates a log with one record per cell name. The topics are
+// numbered, the timestamps have the given distance.
+func writeLog(assert *asserts.Asserts, start time.Time, distance time.Duration, names ...string) []byte {
+	var buf bytes.Buffer
+	w := recording.NewWriter(&buf)
+	for i, name := range names {
+		topic := "t" + string(rune('0'+i))
+		evt, err := mesh.NewEvent(topic, mesh.WithTimestamp(start.Add(time.Duration(i)*distance)))
+		assert.NoError(err)
+		assert.NoError(w.Write(recording.Record{Cell: name, Event: evt}))
+	}
+	return buf.Bytes()
+}
+
+// EOF
@@ -0,0 +1,160 @@
+// Tideland Go Cells - Recording
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package recording // import "tideland.dev/go/cells/recording"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// REPLAY OPTIONS
+//--------------------
+
+// replayConfig contains the configuration of a replay.
+type replayConfig struct {
+	speed  float64
+	target string
+	clock  mesh.Clock
+}
+
+// ReplayOption defines a function setting an option of a replay.
+type ReplayOption func(cfg *replayConfig)
+
+// WithSpeed sets the speed factor of a replay. The times between the
+// events are divided by it, a speed of 0 or less replays the events
+// as fast as possible. By default it is 1, the original timing.
+func WithSpeed(speed float64) ReplayOption {
+	return func(cfg *replayConfig) {
+		cfg.speed = speed
+	}
+}
+
+// WithTarget sets the cell all events are emitted to. By default
+// the events are emitted to the subscribers of the cells named in
+// the records.
+func WithTarget(name string) ReplayOption {
+	return func(cfg *replayConfig) {
+		cfg.target = name
+	}
+}
+
+// WithClock sets the clock used for waiting between the events. By
+// default it is the real clock.
+func WithClock(clock mesh.Clock) ReplayOption {
+	return func(cfg *replayConfig) {
+		cfg.clock = clock
+	}
+}
+
+//--------------------
+// REPLAY
+//--------------------
+
+// meshTopics contains the topics of the events the mesh emits itself
+// when cells terminate, fail, or are restarted.
+var meshTopics = map[string]bool{
+	mesh.TopicTerminated: true,
+	mesh.TopicError:      true,
+	mesh.TopicRestarted:  true,
+	mesh.TopicGivenUp:    true,
+}
+
+// Replay reads the records of the log and emits their events into the
+// mesh. As the records contain the events emitted by the named cells,
+// their events are emitted to the subscribers of those cells like the
+// cells emitted them again. Records without cell need a target cell
+// the events are emitted to instead. The times between the events are
+// kept based on their timestamps and the speed. Recorded termination,
+// error, restart, and given-up events are skipped, the mesh emits
+// them itself. The replay ends at the end of the log, with the first
+// error, or when the context is done.
+func Replay(ctx context.Context, msh mesh.Mesh, r io.Reader, options ...ReplayOption) error {
+	cfg := &replayConfig{
+		speed: 1,
+		clock: mesh.NewRealClock(),
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+	reader := NewReader(r)
+	var last time.Time
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if meshTopics[rec.Event.Topic()] {
+			continue
+		}
+		if cfg.target == "" && rec.Cell == "" {
+			return fmt.Errorf("line %d: record has no cell and no target is set", reader.Line())
+		}
+		timestamp := rec.Event.Timestamp()
+		if cfg.speed > 0 && !last.IsZero() && timestamp.After(last) {
+			delay := time.Duration(float64(timestamp.Sub(last)) / cfg.speed)
+			timer := cfg.clock.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C():
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !timestamp.IsZero() {
+			last = timestamp
+		}
+		if cfg.target != "" {
+			err = msh.EmitEvent(cfg.target, rec.Event)
+		} else {
+			err = emitToSubscribers(msh, rec.Cell, rec.Event)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", reader.Line(), err)
+		}
+	}
+}
+
+// emitToSubscribers emits a copy of the event to each subscriber of
+// the named cell whose topic patterns match it.
+func emitToSubscribers(msh mesh.Mesh, name string, evt *mesh.Event) error {
+	subscribers, err := msh.Subscribers(name)
+	if err != nil {
+		return err
+	}
+	for _, subscriber := range subscribers {
+		patterns, err := msh.SubscriptionTopics(name, subscriber)
+		if err != nil {
+			// Unsubscribed in the meantime.
+			continue
+		}
+		if !mesh.MatchTopics(patterns, evt.Topic()) {
+			continue
+		}
+		if err := msh.EmitEvent(subscriber, evt.With()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EOF
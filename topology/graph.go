@@ -0,0 +1,225 @@
+// Tideland Go Cells - Topology
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package topology // import "tideland.dev/go/cells/topology"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// GRAPH
+//--------------------
+
+// Node is a cell in a graph. Parent is the name of the cell which
+// started this one, otherwise it's empty.
+type Node struct {
+	Name     string
+	Behavior string
+	Parent   string
+}
+
+// Edge is a subscription in a graph. If Counted is true Count
+// contains the number of events delivered from emitter to receptor.
+type Edge struct {
+	Emitter  string
+	Receptor string
+	Topics   []string
+	Count    uint64
+	Counted  bool
+}
+
+// Graph describes the shape of a mesh for rendering it as diagram.
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+// Graph returns the graph of the topology before it is built. Nodes
+// are labelled with the behavior kind.
+func (t *Topology) Graph() *Graph {
+	g := &Graph{}
+	for _, c := range t.Cells {
+		g.Nodes = append(g.Nodes, Node{
+			Name:     c.Name,
+			Behavior: c.Kind,
+		})
+	}
+	for _, s := range t.Subscriptions {
+		g.Edges = append(g.Edges, Edge{
+			Emitter:  s.Emitter,
+			Receptor: s.Receptor,
+			Topics:   append([]string(nil), s.Topics...),
+		})
+	}
+	return g
+}
+
+// FromMesh walks the cells of a running mesh and returns its graph.
+// Nodes are labelled with the behavior type. If counts is true the
+// edges contain the number of delivered events. Cells stopping
+// during the walk are skipped.
+func FromMesh(msh mesh.Mesh, counts bool) *Graph {
+	g := &Graph{}
+	infos := make(map[string]mesh.CellInfo)
+	for _, name := range msh.Cells() {
+		info, err := msh.CellInfo(name)
+		if err != nil {
+			continue
+		}
+		infos[name] = info
+		g.Nodes = append(g.Nodes, Node{
+			Name:     info.Name,
+			Behavior: info.Behavior,
+			Parent:   info.Parent,
+		})
+	}
+	for _, node := range g.Nodes {
+		subscribers, err := msh.Subscribers(node.Name)
+		if err != nil {
+			continue
+		}
+		for _, subscriber := range subscribers {
+			if _, ok := infos[subscriber]; !ok {
+				continue
+			}
+			topics, err := msh.SubscriptionTopics(node.Name, subscriber)
+			if err != nil {
+				continue
+			}
+			edge := Edge{
+				Emitter:  node.Name,
+				Receptor: subscriber,
+				Topics:   topics,
+			}
+			if counts {
+				edge.Count = infos[node.Name].Delivered[subscriber]
+				edge.Counted = true
+			}
+			g.Edges = append(g.Edges, edge)
+		}
+	}
+	return g
+}
+
+// DOT renders the graph in the Graphviz DOT language. Edges from
+// parent to child cells are drawn dotted.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph mesh {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(node.Name), dotQuote(node.label()))
+	}
+	for _, edge := range g.Edges {
+		label := edge.label()
+		if label == "" {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(edge.Emitter), dotQuote(edge.Receptor))
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(edge.Emitter), dotQuote(edge.Receptor), dotQuote(label))
+	}
+	for _, node := range g.children() {
+		fmt.Fprintf(&b, "\t%s -> %s [style=dotted, arrowhead=none];\n", dotQuote(node.Parent), dotQuote(node.Name))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as Mermaid flowchart. Edges from parent
+// to child cells are drawn dotted.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+	ids := make(map[string]string, len(g.Nodes))
+	id := func(name string) string {
+		if nid, ok := ids[name]; ok {
+			return nid
+		}
+		nid := fmt.Sprintf("n%d", len(ids))
+		ids[name] = nid
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", nid, mermaidEscape(name))
+		return nid
+	}
+	b.WriteString("flowchart LR\n")
+	for _, node := range g.Nodes {
+		nid := fmt.Sprintf("n%d", len(ids))
+		ids[node.Name] = nid
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", nid, mermaidEscape(node.label()))
+	}
+	for _, edge := range g.Edges {
+		from, to := id(edge.Emitter), id(edge.Receptor)
+		label := edge.label()
+		if label == "" {
+			fmt.Fprintf(&b, "\t%s --> %s\n", from, to)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s -->|\"%s\"| %s\n", from, mermaidEscape(label), to)
+	}
+	for _, node := range g.children() {
+		fmt.Fprintf(&b, "\t%s -.- %s\n", id(node.Parent), id(node.Name))
+	}
+	return b.String()
+}
+
+// children returns the nodes having a parent, sorted by name.
+func (g *Graph) children() []Node {
+	var children []Node
+	for _, node := range g.Nodes {
+		if node.Parent != "" {
+			children = append(children, node)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// label returns the label of a node with name and behavior.
+func (n Node) label() string {
+	if n.Behavior == "" {
+		return n.Name
+	}
+	return n.Name + "\n" + n.Behavior
+}
+
+// label returns the label of an edge with topics and count.
+func (e Edge) label() string {
+	var parts []string
+	if len(e.Topics) > 0 {
+		parts = append(parts, strings.Join(e.Topics, ", "))
+	}
+	if e.Counted {
+		parts = append(parts, fmt.Sprintf("%d events", e.Count))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// dotQuote returns the string as quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// mermaidEscape escapes the string for a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
+
+// EOF
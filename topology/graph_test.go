@@ -0,0 +1,112 @@
+// Tideland Go Cells - Topology - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package topology_test // import "tideland.dev/go/cells/topology"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/topology"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTopologyGraph verifies the rendering of a topology before
+// it is built.
+func TestTopologyGraph(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	topo, err := topology.Parse([]byte(yamlTopology))
+	assert.NoError(err)
+	g := topo.Graph()
+	assert.Length(g.Nodes, 2)
+	assert.Length(g.Edges, 1)
+
+	dot := g.DOT()
+	assert.True(strings.HasPrefix(dot, "digraph mesh {\n"))
+	assert.Contains(`"input" [label="input\nbroadcaster"];`, dot)
+	assert.Contains(`"counter" [label="counter\ncounter"];`, dot)
+	assert.Contains(`"input" -> "counter" [label="alarm.fire, alarm.water"];`, dot)
+
+	mermaid := g.Mermaid()
+	assert.True(strings.HasPrefix(mermaid, "flowchart LR\n"))
+	assert.Contains(`n0["input<br/>broadcaster"]`, mermaid)
+	assert.Contains(`n1["counter<br/>counter"]`, mermaid)
+	assert.Contains(`n0 -->|"alarm.fire, alarm.water"| n1`, mermaid)
+
+	// Quotes are escaped.
+	g = &topology.Graph{
+		Nodes: []topology.Node{{Name: `say "hello"`}},
+	}
+	assert.Contains(`"say \"hello\"" [label="say \"hello\""];`, g.DOT())
+	assert.Contains(`n0["say #quot;hello#quot;"]`, g.Mermaid())
+}
+
+// TestMeshGraph verifies the rendering of a running mesh including
+// the counts of delivered events and child cells.
+func TestMeshGraph(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	topo, err := topology.Parse([]byte(jsonTopology))
+	assert.NoError(err)
+	assert.NoError(topo.Build(msh, nil))
+	waitFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		<-cell.Context().Done()
+		return nil
+	}
+	parentFunc := func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		if err := cell.Mesh().Go("child", mesh.BehaviorFunc(waitFunc)); err != nil {
+			return err
+		}
+		return waitFunc(cell, in, out)
+	}
+	assert.NoError(msh.Go("parent", mesh.BehaviorFunc(parentFunc)))
+
+	for _, topic := range []string{"alarm.fire", "info", "alarm.water"} {
+		assert.NoError(msh.Emit("input", topic))
+	}
+	assert.Retry(func() bool {
+		info, err := msh.CellInfo("alarms")
+		return err == nil && info.Delivered["counter"] == 2
+	}, 10, 10*time.Millisecond, "events not delivered")
+
+	assert.Retry(func() bool {
+		_, err := msh.CellInfo("child")
+		return err == nil
+	}, 10, 10*time.Millisecond, "child not started")
+
+	g := topology.FromMesh(msh, false)
+	assert.Length(g.Nodes, 5)
+	assert.Length(g.Edges, 2)
+	assert.Contains(`"input" -> "alarms";`, g.DOT())
+
+	g = topology.FromMesh(msh, true)
+	dot := g.DOT()
+	assert.Contains(`"alarms" [label="alarms\n*filter.Behavior"];`, dot)
+	assert.Contains(`"input" -> "alarms" [label="3 events"];`, dot)
+	assert.Contains(`"alarms" -> "counter" [label="2 events"];`, dot)
+	assert.Contains(`"parent" -> "child" [style=dotted, arrowhead=none];`, dot)
+
+	mermaid := g.Mermaid()
+	assert.Contains(`-->|"2 events"|`, mermaid)
+	assert.Contains(` -.- `, mermaid)
+}
+
+// EOF
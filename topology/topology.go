@@ -0,0 +1,237 @@
+// Tideland Go Cells - Topology
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package topology allows to describe meshes declaratively in JSON or
+// YAML and to build them. A topology contains the cells with the kind
+// of their behavior and its parameters, and the subscriptions between
+// the cells with optional topic patterns. The behaviors are created by
+// the factories of a mesh.BehaviorRegistry, by default the one the
+// packages of the behaviors register at when they are imported.
+//
+//	cells:
+//	  - name: sensors
+//	    kind: broadcaster
+//	  - name: alarms
+//	    kind: filter
+//	    params:
+//	      topics: ["alarm.**"]
+//	subscriptions:
+//	  - emitter: sensors
+//	    receptor: alarms
+//
+// Such a topology is read and built with
+//
+//	topo, err := topology.ReadFile("mesh.yaml")
+//	err = topo.Build(msh, nil)
+//
+// The shape of a topology or of a running mesh can be rendered as
+// Graphviz DOT or Mermaid diagram, the latter optionally with the
+// number of events delivered via each subscription.
+//
+//	dot := topo.Graph().DOT()
+//	mermaid := topology.FromMesh(msh, true).Mermaid()
+package topology // import "tideland.dev/go/cells/topology"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TOPOLOGY
+//--------------------
+
+// Cell describes one cell of the topology.
+type Cell struct {
+	Name   string              `json:"name" yaml:"name"`
+	Kind   string              `json:"kind" yaml:"kind"`
+	Params mesh.BehaviorParams `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+// Subscription describes the subscription of the receptor cell to
+// the events of the emitter cell. Topics optionally contains patterns
+// limiting the subscribed events.
+type Subscription struct {
+	Emitter  string   `json:"emitter" yaml:"emitter"`
+	Receptor string   `json:"receptor" yaml:"receptor"`
+	Topics   []string `json:"topics,omitempty" yaml:"topics,omitempty"`
+}
+
+// Topology describes a mesh declaratively.
+type Topology struct {
+	Cells         []Cell         `json:"cells" yaml:"cells"`
+	Subscriptions []Subscription `json:"subscriptions,omitempty" yaml:"subscriptions,omitempty"`
+}
+
+// ReadFile reads a topology from a file. Files with the extension
+// ".json" are read as JSON, all others as YAML.
+func ReadFile(filename string) (*Topology, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read topology: %v", err)
+	}
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		return ParseJSON(data)
+	}
+	return ParseYAML(data)
+}
+
+// Parse reads a topology from JSON if the data starts with a brace,
+// otherwise from YAML.
+func Parse(data []byte) (*Topology, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return ParseJSON(data)
+	}
+	return ParseYAML(data)
+}
+
+// ParseJSON reads a topology from JSON.
+func ParseJSON(data []byte) (*Topology, error) {
+	var t Topology
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("cannot parse topology: %v", err)
+	}
+	return &t, nil
+}
+
+// ParseYAML reads a topology from YAML.
+func ParseYAML(data []byte) (*Topology, error) {
+	var t Topology
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("cannot parse topology: %v", err)
+	}
+	return &t, nil
+}
+
+// Validate checks the topology without creating any behavior. It
+// reports empty and duplicate cell names, unknown behavior kinds,
+// invalid topic patterns, and dangling or duplicate subscriptions.
+// A nil registry means the default behavior registry.
+func (t *Topology) Validate(registry *mesh.BehaviorRegistry) error {
+	if registry == nil {
+		registry = mesh.DefaultBehaviorRegistry()
+	}
+	var problems []string
+	names := make(map[string]bool)
+	for i, c := range t.Cells {
+		switch {
+		case c.Name == "":
+			problems = append(problems, fmt.Sprintf("cell #%d has no name", i+1))
+		case names[c.Name]:
+			problems = append(problems, fmt.Sprintf("cell name '%s' is used more than once", c.Name))
+		}
+		names[c.Name] = true
+		switch {
+		case c.Kind == "":
+			problems = append(problems, fmt.Sprintf("cell '%s' has no behavior kind", c.Name))
+		case !registry.Has(c.Kind):
+			problems = append(problems, fmt.Sprintf("cell '%s' has unknown behavior kind '%s'", c.Name, c.Kind))
+		}
+	}
+	subscriptions := make(map[[2]string]bool)
+	for _, s := range t.Subscriptions {
+		if !names[s.Emitter] {
+			problems = append(problems, fmt.Sprintf("subscription of '%s' to unknown emitter cell '%s'", s.Receptor, s.Emitter))
+		}
+		if !names[s.Receptor] {
+			problems = append(problems, fmt.Sprintf("subscription of unknown receptor cell '%s' to '%s'", s.Receptor, s.Emitter))
+		}
+		key := [2]string{s.Emitter, s.Receptor}
+		if subscriptions[key] {
+			problems = append(problems, fmt.Sprintf("subscription of '%s' to '%s' is defined more than once", s.Receptor, s.Emitter))
+		}
+		subscriptions[key] = true
+		if err := mesh.ValidateTopicPatterns(s.Topics); err != nil {
+			problems = append(problems, fmt.Sprintf("subscription of '%s' to '%s': %v", s.Receptor, s.Emitter, err))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{
+			Problems: problems,
+		}
+	}
+	return nil
+}
+
+// Build validates the topology, creates all behaviors, and only if
+// this succeeded starts the cells in the mesh and subscribes them.
+// A nil registry means the default behavior registry.
+func (t *Topology) Build(msh mesh.Mesh, registry *mesh.BehaviorRegistry) error {
+	if registry == nil {
+		registry = mesh.DefaultBehaviorRegistry()
+	}
+	if err := t.Validate(registry); err != nil {
+		return err
+	}
+	var problems []string
+	behaviors := make([]mesh.Behavior, len(t.Cells))
+	for i, c := range t.Cells {
+		b, err := registry.Create(c.Kind, c.Params)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cell '%s': %v", c.Name, err))
+			continue
+		}
+		behaviors[i] = b
+	}
+	if len(problems) > 0 {
+		return &ValidationError{
+			Problems: problems,
+		}
+	}
+	var started []string
+	for i, c := range t.Cells {
+		if err := msh.Go(c.Name, behaviors[i]); err != nil {
+			stopCells(msh, started)
+			return fmt.Errorf("cannot start cell '%s': %v", c.Name, err)
+		}
+		started = append(started, c.Name)
+	}
+	for _, s := range t.Subscriptions {
+		if err := msh.SubscribeTopics(s.Emitter, s.Receptor, s.Topics...); err != nil {
+			stopCells(msh, started)
+			return fmt.Errorf("cannot subscribe '%s' to '%s': %v", s.Receptor, s.Emitter, err)
+		}
+	}
+	return nil
+}
+
+// stopCells stops the cells started by a failed build in reverse
+// order. Their errors are ignored, the build error is more important.
+func stopCells(msh mesh.Mesh, names []string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		msh.Stop(names[i])
+	}
+}
+
+//--------------------
+// ERRORS
+//--------------------
+
+// ValidationError contains all problems found when validating a
+// topology or creating its behaviors.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return "invalid topology: " + strings.Join(e.Problems, "; ")
+}
+
+// EOF
@@ -0,0 +1,208 @@
+// Tideland Go Cells - Topology - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package topology_test // import "tideland.dev/go/cells/topology"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/behaviors/broadcaster"
+	"tideland.dev/go/cells/behaviors/counter"
+	_ "tideland.dev/go/cells/behaviors/filter"
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/topology"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const jsonTopology = `{
+	"cells": [
+		{"name": "input", "kind": "broadcaster"},
+		{"name": "alarms", "kind": "filter", "params": {"topics": ["alarm.**"]}},
+		{"name": "counter", "kind": "counter"}
+	],
+	"subscriptions": [
+		{"emitter": "input", "receptor": "alarms"},
+		{"emitter": "alarms", "receptor": "counter"}
+	]
+}`
+
+const yamlTopology = `
+cells:
+  - name: input
+    kind: broadcaster
+  - name: counter
+    kind: counter
+    params:
+      topics: ["alarm.**"]
+subscriptions:
+  - emitter: input
+    receptor: counter
+    topics:
+      - alarm.fire
+      - alarm.water
+`
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestParse verifies the parsing of JSON and YAML topologies.
+func TestParse(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	topo, err := topology.Parse([]byte(jsonTopology))
+	assert.NoError(err)
+	assert.Length(topo.Cells, 3)
+	assert.Equal(topo.Cells[1].Kind, "filter")
+	topics, err := topo.Cells[1].Params.Strings("topics", nil)
+	assert.NoError(err)
+	assert.Equal(topics, []string{"alarm.**"})
+	assert.Length(topo.Subscriptions, 2)
+
+	topo, err = topology.Parse([]byte(yamlTopology))
+	assert.NoError(err)
+	assert.Length(topo.Cells, 2)
+	assert.Equal(topo.Subscriptions[0].Topics, []string{"alarm.fire", "alarm.water"})
+
+	_, err = topology.Parse([]byte("{ broken"))
+	assert.ErrorContains(err, "cannot parse topology")
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "mesh.json")
+	assert.NoError(os.WriteFile(filename, []byte(jsonTopology), 0644))
+	topo, err = topology.ReadFile(filename)
+	assert.NoError(err)
+	assert.Length(topo.Cells, 3)
+	filename = filepath.Join(dir, "mesh.yaml")
+	assert.NoError(os.WriteFile(filename, []byte(yamlTopology), 0644))
+	topo, err = topology.ReadFile(filename)
+	assert.NoError(err)
+	assert.Length(topo.Cells, 2)
+	_, err = topology.ReadFile(filepath.Join(dir, "dont-exist.yaml"))
+	assert.ErrorContains(err, "cannot read topology")
+}
+
+// TestValidate verifies the reporting of all problems of a topology.
+func TestValidate(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	topo := &topology.Topology{
+		Cells: []topology.Cell{
+			{Name: "a", Kind: broadcaster.Kind},
+			{Name: "a", Kind: broadcaster.Kind},
+			{Name: "", Kind: broadcaster.Kind},
+			{Name: "b", Kind: "dont-exist"},
+			{Name: "c"},
+		},
+		Subscriptions: []topology.Subscription{
+			{Emitter: "a", Receptor: "b"},
+			{Emitter: "a", Receptor: "b"},
+			{Emitter: "x", Receptor: "a"},
+			{Emitter: "a", Receptor: "y"},
+			{Emitter: "a", Receptor: "c", Topics: []string{"[invalid"}},
+		},
+	}
+	err := topo.Validate(nil)
+	verr, ok := err.(*topology.ValidationError)
+	assert.True(ok)
+	assert.Equal(verr.Problems, []string{
+		"cell name 'a' is used more than once",
+		"cell #3 has no name",
+		"cell 'b' has unknown behavior kind 'dont-exist'",
+		"cell 'c' has no behavior kind",
+		"subscription of 'b' to 'a' is defined more than once",
+		"subscription of 'a' to unknown emitter cell 'x'",
+		"subscription of unknown receptor cell 'y' to 'a'",
+		"subscription of 'c' to 'a': invalid topic pattern '[invalid': syntax error in pattern",
+	})
+
+	// Nothing is started if validation fails.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	assert.ErrorContains(topo.Build(msh, nil), "invalid topology")
+	assert.Empty(msh.Cells())
+
+	// Same for invalid parameters.
+	topo = &topology.Topology{
+		Cells: []topology.Cell{
+			{Name: "input", Kind: broadcaster.Kind},
+			{Name: "filter", Kind: "filter", Params: mesh.BehaviorParams{"mode": "including"}},
+		},
+	}
+	assert.NoError(topo.Validate(nil))
+	assert.ErrorContains(topo.Build(msh, nil), "cell 'filter': cannot create behavior kind 'filter': parameter 'topics' is missing")
+	assert.Empty(msh.Cells())
+}
+
+// TestBuild verifies the building of meshes out of topologies.
+func TestBuild(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	for _, source := range []string{jsonTopology, yamlTopology} {
+		ctx, cancel := context.WithCancel(context.Background())
+		msh := mesh.New(ctx)
+		topo, err := topology.Parse([]byte(source))
+		assert.NoError(err)
+		assert.NoError(topo.Build(msh, nil))
+
+		for _, topic := range []string{"alarm.fire", "info", "alarm.water", "alarm.fire", "alarm.air"} {
+			assert.NoError(msh.Emit("input", topic))
+		}
+		var counters map[string]int
+		assert.Retry(func() bool {
+			rctx, rcancel := context.WithTimeout(ctx, time.Second)
+			defer rcancel()
+			reply, err := msh.Request(rctx, "counter", counter.TopicCounters)
+			if err != nil {
+				return false
+			}
+			counters = nil
+			if err := reply.Payload(&counters); err != nil {
+				return false
+			}
+			return counters["alarm.fire"] == 2 && counters["alarm.water"] == 1
+		}, 10, 10*time.Millisecond, "counters not reached")
+		assert.Equal(counters["info"], 0)
+
+		// Second building fails due to used names.
+		assert.ErrorContains(topo.Build(msh, nil), "cell name 'input' already used")
+
+		cancel()
+	}
+}
+
+// TestBuildFailure verifies that a failing build stops the cells
+// already started.
+func TestBuildFailure(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msh := mesh.New(ctx)
+	assert.NoError(msh.Go("counter", mesh.BehaviorFunc(func(cell mesh.Cell, in mesh.Receptor, out mesh.Emitter) error {
+		<-cell.Context().Done()
+		return nil
+	})))
+	topo, err := topology.Parse([]byte(jsonTopology))
+	assert.NoError(err)
+
+	assert.ErrorContains(topo.Build(msh, nil), "cell name 'counter' already used")
+	assert.Equal(msh.Cells(), []string{"counter"})
+}
+
+// EOF
@@ -0,0 +1,140 @@
+// Tideland Go Cells - Tracing
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package tracing adapts OpenTelemetry tracers for the tracing of the
+// event flow of a mesh. The emitting of events becomes a producer span,
+// the processing by the behaviors a consumer span, e.g.
+//
+//	tracer := tracing.NewTracer(provider.Tracer("tideland.dev/go/cells"))
+//	msh := mesh.New(ctx, mesh.WithTracer(tracer))
+//
+// The span contexts are propagated with the events, also when they
+// are marshalled to JSON. So traces continue across processes. The
+// events also carry the sampling decision, so parent based samplers
+// follow the decision of the emitter.
+package tracing // import "tideland.dev/go/cells/tracing"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tideland.dev/go/cells/mesh"
+)
+
+//--------------------
+// TRACER
+//--------------------
+
+// Tracer adapts an OpenTelemetry tracer to the mesh.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a tracer for the mesh using the passed
+// OpenTelemetry tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{
+		tracer: tracer,
+	}
+}
+
+// Start implements mesh.Tracer.
+func (t *Tracer) Start(name string, kind mesh.SpanKind, parent mesh.SpanContext) mesh.Span {
+	ctx := context.Background()
+	if psc, ok := toOTel(parent); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, psc)
+	}
+	spanKind := trace.SpanKindProducer
+	if kind == mesh.SpanProcess {
+		spanKind = trace.SpanKindConsumer
+	}
+	_, s := t.tracer.Start(ctx, name, trace.WithSpanKind(spanKind))
+	return &span{
+		span: s,
+	}
+}
+
+//--------------------
+// SPAN
+//--------------------
+
+// span adapts an OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+// SpanContext implements mesh.Span.
+func (s *span) SpanContext() mesh.SpanContext {
+	return fromOTel(s.span.SpanContext())
+}
+
+// SetAttribute implements mesh.Span.
+func (s *span) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// SetError implements mesh.Span.
+func (s *span) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End implements mesh.Span.
+func (s *span) End() {
+	s.span.End()
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// toOTel converts a span context of the mesh into an OpenTelemetry
+// remote span context.
+func toOTel(sc mesh.SpanContext) (trace.SpanContext, bool) {
+	if !sc.IsValid() {
+		return trace.SpanContext{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(sc.TraceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(sc.SpanID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var flags trace.TraceFlags
+	if sc.Sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	}), true
+}
+
+// fromOTel converts an OpenTelemetry span context into one of the mesh.
+func fromOTel(sc trace.SpanContext) mesh.SpanContext {
+	if !sc.IsValid() {
+		return mesh.SpanContext{}
+	}
+	return mesh.SpanContext{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Sampled: sc.IsSampled(),
+	}
+}
+
+// EOF
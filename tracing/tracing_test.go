@@ -0,0 +1,107 @@
+// Tideland Go Cells - Tracing - Tests
+//
+// Copyright (C) 2010-2021 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package tracing_test // import "tideland.dev/go/cells/tracing"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"tideland.dev/go/audit/asserts"
+
+	"tideland.dev/go/cells/mesh"
+	"tideland.dev/go/cells/tracing"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTracer verifies the adapter with single spans.
+func TestTracer(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tracing.NewTracer(provider.Tracer("test"))
+
+	parent := mesh.SpanContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+		Sampled: true,
+	}
+	span := tracer.Start("process a", mesh.SpanProcess, parent)
+	span.SetAttribute(mesh.SpanAttrCell, "foo")
+	span.SetError(errors.New("ouch"))
+	span.End()
+	root := tracer.Start("emit b", mesh.SpanEmit, mesh.SpanContext{})
+	root.End()
+
+	// Decision of the emitter not to sample is kept.
+	unsampled := parent
+	unsampled.Sampled = false
+	dropped := tracer.Start("process c", mesh.SpanProcess, unsampled)
+	dropped.End()
+	assert.False(dropped.SpanContext().Sampled)
+
+	ended := recorder.Ended()
+	assert.Length(ended, 2)
+	assert.Equal(ended[0].Name(), "process a")
+	assert.Equal(ended[0].SpanKind(), trace.SpanKindConsumer)
+	assert.Equal(ended[0].SpanContext().TraceID().String(), parent.TraceID)
+	assert.Equal(ended[0].Parent().SpanID().String(), parent.SpanID)
+	assert.True(ended[0].Parent().IsRemote())
+	assert.Equal(span.SpanContext().SpanID, ended[0].SpanContext().SpanID().String())
+	assert.Equal(ended[0].Status().Code, codes.Error)
+	assert.Equal(ended[0].Status().Description, "ouch")
+	assert.Length(ended[0].Attributes(), 1)
+	assert.Equal(string(ended[0].Attributes()[0].Key), mesh.SpanAttrCell)
+	assert.Equal(ended[0].Attributes()[0].Value.AsString(), "foo")
+
+	assert.Equal(ended[1].SpanKind(), trace.SpanKindProducer)
+	assert.False(ended[1].Parent().IsValid())
+	assert.True(root.SpanContext().IsValid())
+	assert.True(root.SpanContext().Sampled)
+	assert.Different(root.SpanContext().TraceID, parent.TraceID)
+}
+
+// TestMeshTracing verifies the traces of a mesh.
+func TestMeshTracing(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	msh := mesh.New(ctx, mesh.WithTracer(tracing.NewTracer(provider.Tracer("test"))))
+	assert.NoError(msh.Go("echo", mesh.NewRequestBehavior(func(cell mesh.Cell, evt *mesh.Event, out mesh.Emitter) error {
+		return out.EmitEvent(evt)
+	})))
+
+	assert.NoError(msh.Emit("echo", "a"))
+	assert.Retry(func() bool {
+		return len(recorder.Ended()) == 3
+	}, 100, 10*time.Millisecond)
+	ended := recorder.Ended()
+	traceID := ended[0].SpanContext().TraceID()
+	for _, span := range ended {
+		assert.Equal(span.SpanContext().TraceID(), traceID)
+	}
+
+	assert.NoError(msh.Shutdown(ctx))
+}
+
+// EOF